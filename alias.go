@@ -0,0 +1,69 @@
+// Copyright (c) 2022 Furzoom.com, All rights reserved.
+// Author: mn, mn@furzoom.com
+
+package goamf
+
+import (
+	"reflect"
+	"sync"
+)
+
+var classAliases = struct {
+	sync.RWMutex
+	byClass map[string]reflect.Type
+	byType  map[reflect.Type]string
+}{
+	byClass: make(map[string]reflect.Type),
+	byType:  make(map[reflect.Type]string),
+}
+
+// RegisterClassAlias maps the class alias className (registerClassAlias in
+// ActionScript) to the struct type of v, which may be a struct or a pointer
+// to a struct.
+//
+// Values of that struct type are encoded as typed objects of className, and
+// typed objects of className are decoded into a new value of the type of v
+// instead of a TypedObject.
+func RegisterClassAlias(className string, v interface{}) {
+	t := reflect.TypeOf(v)
+	st := t
+	if st.Kind() == reflect.Ptr {
+		st = st.Elem()
+	}
+	if st.Kind() != reflect.Struct {
+		panic("goamf: RegisterClassAlias of non-struct type " + t.String())
+	}
+	classAliases.Lock()
+	defer classAliases.Unlock()
+	classAliases.byClass[className] = t
+	classAliases.byType[st] = className
+}
+
+// classAlias returns the class alias registered for the struct type t, or
+// else the one set by its `class` tag.
+func classAlias(t reflect.Type) string {
+	classAliases.RLock()
+	className, ok := classAliases.byType[t]
+	classAliases.RUnlock()
+	if ok {
+		return className
+	}
+	return structClass(t)
+}
+
+// typedValue converts a decoded typed object into the Go type registered for
+// its class alias. Objects of unregistered classes are returned unchanged.
+func typedValue(obj TypedObject, version uint) (interface{}, error) {
+	classAliases.RLock()
+	t, ok := classAliases.byClass[obj.ClassName]
+	classAliases.RUnlock()
+	if !ok {
+		return obj, nil
+	}
+	v := reflect.New(t).Elem()
+	err := unmarshalValue(obj.Object, v, "", version)
+	if err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
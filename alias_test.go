@@ -0,0 +1,111 @@
+// Copyright (c) 2022 Furzoom.com, All rights reserved.
+// Author: mn, mn@furzoom.com
+
+package goamf
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type testUser struct {
+	Name string
+	Age  int
+}
+
+func init() {
+	RegisterClassAlias("test.User", testUser{})
+}
+
+var testUserAmf0 = []byte{
+	0x10, 0x00, 0x09, 't', 'e', 's', 't', '.', 'U', 's', 'e', 'r',
+	0x00, 0x04, 'N', 'a', 'm', 'e', 0x02, 0x00, 0x01, 'a',
+	0x00, 0x03, 'A', 'g', 'e', 0x00, 0x3f, 0xf0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x09,
+}
+
+func TestWriteAliasedStruct(t *testing.T) {
+	for _, value := range []interface{}{testUser{"a", 1}, &testUser{"a", 1}} {
+		buf := new(bytes.Buffer)
+		n, err := WriteValue(buf, value)
+		if err != nil {
+			t.Fatalf("WriteValue error: %s", err)
+		}
+		got := buf.Bytes()
+		if !bytes.Equal(got, testUserAmf0) || n != len(testUserAmf0) {
+			t.Errorf("WriteValue expect %x got %x, n: %d", testUserAmf0, got, n)
+		}
+	}
+}
+
+func TestReadTypedObject(t *testing.T) {
+	value, err := ReadValue(bytes.NewReader(testUserAmf0))
+	if err != nil {
+		t.Fatalf("ReadValue error: %s", err)
+	}
+	if !reflect.DeepEqual(value, testUser{"a", 1}) {
+		t.Errorf("ReadValue expect %#v got %#v", testUser{"a", 1}, value)
+	}
+
+	data := []byte{
+		0x10, 0x00, 0x03, 'a', '.', 'B',
+		0x00, 0x01, 'x', 0x01, 0x01,
+		0x00, 0x00, 0x09,
+	}
+	value, err = ReadValue(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadValue error: %s", err)
+	}
+	expect := TypedObject{ClassName: "a.B", Object: Object{"x": true}}
+	if !reflect.DeepEqual(value, expect) {
+		t.Errorf("ReadValue expect %#v got %#v", expect, value)
+	}
+
+	buf := new(bytes.Buffer)
+	_, err = WriteValue(buf, expect)
+	if err != nil {
+		t.Fatalf("WriteValue error: %s", err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("WriteValue expect %x got %x", data, buf.Bytes())
+	}
+}
+
+func TestAMF3_AliasedStruct(t *testing.T) {
+	buf := new(bytes.Buffer)
+	_, err := Amf3WriteValue(buf, []interface{}{testUser{"a", 1}, testUser{"b", 2}})
+	if err != nil {
+		t.Fatalf("Amf3WriteValue error: %s", err)
+	}
+	expect := []byte{0x09, 0x05, 0x01,
+		0x0A, 0x23, 0x13, 't', 'e', 's', 't', '.', 'U', 's', 'e', 'r', 0x09, 'N', 'a', 'm', 'e', 0x07, 'A', 'g', 'e',
+		0x06, 0x03, 'a', 0x04, 0x01,
+		0x0A, 0x01, 0x06, 0x03, 'b', 0x04, 0x02, // traits by reference
+	}
+	got := buf.Bytes()
+	if !bytes.Equal(expect, got) {
+		t.Errorf("Amf3WriteValue expect %x got %x", expect, got)
+	}
+
+	var users []testUser
+	err = Unmarshal(got, AMF3, &users)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %s", err)
+	}
+	if !reflect.DeepEqual(users, []testUser{{"a", 1}, {"b", 2}}) {
+		t.Errorf("Unmarshal got %#v", users)
+	}
+}
+
+func TestWriteStructUnexportedStructField(t *testing.T) {
+	value := struct {
+		Name string
+		user testUser
+	}{Name: "a"}
+	buf := new(bytes.Buffer)
+	_, err := WriteValue(buf, value)
+	if err != nil {
+		t.Fatalf("WriteValue error: %s", err)
+	}
+}
@@ -7,8 +7,6 @@ import (
 	"encoding/binary"
 	"fmt"
 	"reflect"
-	"sort"
-	"strings"
 	"time"
 )
 
@@ -45,6 +43,42 @@ func WriteString(w Writer, str string) (n int, err error) {
 	return int(length), nil
 }
 
+// WriteDate writes t as a date-type with a zero time zone, in milliseconds
+// since the Unix epoch.
+func WriteDate(w Writer, t time.Time) (n int, err error) {
+	return WriteDateTimezone(w, Date{Time: t})
+}
+
+// WriteDateTimezone writes date as a date-type, keeping its time zone field.
+func WriteDateTimezone(w Writer, date Date) (n int, err error) {
+	err = w.WriteByte(Amf0DateMarker)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Write(w, binary.BigEndian, float64(date.Time.UnixMilli()))
+	if err != nil {
+		return 1, err
+	}
+	err = binary.Write(w, binary.BigEndian, date.Timezone)
+	if err != nil {
+		return 9, err
+	}
+	return 11, nil
+}
+
+func WriteXMLDocument(w Writer, doc XMLDocument) (n int, err error) {
+	err = w.WriteByte(Amf0XMLDocumentMarker)
+	if err != nil {
+		return 0, err
+	}
+	length := uint32(len(doc))
+	err = WriteUTF8Long(w, string(doc), length)
+	if err != nil {
+		return 1, err
+	}
+	return int(length + 5), nil
+}
+
 func WriteUTF8(w Writer, s string, length uint16) error {
 	err := binary.Write(w, binary.BigEndian, &length)
 	if err != nil {
@@ -108,30 +142,171 @@ func WriteUndefined(w Writer) (n int, err error) {
 }
 
 func WriteEcmaArray(w Writer, arr []interface{}) (n int, err error) {
-	n, err = WriteMarker(w, Amf0EcmaArrayMarker)
+	return NewEncoder(w, AMF0).writeEcmaArray(arr)
+}
+
+func (e *Encoder) writeEcmaArray(arr []interface{}) (n int, err error) {
+	v := reflect.ValueOf(arr)
+	n, ok, err := e.writeReference(v)
+	if ok || err != nil {
+		return
+	}
+	return e.writeSliceEcmaArray(v)
+}
+
+// writeSliceEcmaArray writes the slice or array v as an ECMA array with the
+// indices as property names.
+func (e *Encoder) writeSliceEcmaArray(v reflect.Value) (n int, err error) {
+	length := v.Len()
+	n, err = e.writeEcmaArrayHeader(uint32(length))
+	if err != nil {
+		return
+	}
+	m := 0
+	for index := 0; index < length; index++ {
+		m, err = WriteObjectName(e.w, fmt.Sprintf("%d", index))
+		if err != nil {
+			return
+		}
+		n += m
+		m, err = e.writeValue(v.Index(index))
+		if err != nil {
+			return
+		}
+		n += m
+	}
+	m, err = WriteObjectEndMarker(e.w)
+	return n + m, err
+}
+
+func WriteStrictArray(w Writer, arr []interface{}) (n int, err error) {
+	return NewEncoder(w, AMF0).writeStrictArray(arr)
+}
+
+func (e *Encoder) writeStrictArray(arr []interface{}) (n int, err error) {
+	v := reflect.ValueOf(arr)
+	n, ok, err := e.writeReference(v)
+	if ok || err != nil {
+		return
+	}
+	return e.writeSliceStrictArray(v)
+}
+
+// writeSliceStrictArray writes the slice or array v as a strict array.
+func (e *Encoder) writeSliceStrictArray(v reflect.Value) (n int, err error) {
+	n, err = WriteMarker(e.w, Amf0StrictArrayMarker)
 	if err != nil {
 		return
 	}
-	length := len(arr)
-	err = binary.Write(w, binary.BigEndian, &length)
+	length := v.Len()
+	err = binary.Write(e.w, binary.BigEndian, uint32(length))
 	if err != nil {
 		return
 	}
 	n += 4
 	m := 0
-	for index, value := range arr {
-		m, err = WriteObjectName(w, fmt.Sprintf("%d", index))
+	for index := 0; index < length; index++ {
+		m, err = e.writeValue(v.Index(index))
 		if err != nil {
 			return
 		}
 		n += m
-		m, err = WriteValue(w, value)
+	}
+	return n, nil
+}
+
+// writeEcmaArrayHeader writes the ECMA array marker and the associative
+// count. The properties and the object end marker follow it.
+func (e *Encoder) writeEcmaArrayHeader(count uint32) (n int, err error) {
+	n, err = WriteMarker(e.w, Amf0EcmaArrayMarker)
+	if err != nil {
+		return
+	}
+	err = binary.Write(e.w, binary.BigEndian, count)
+	if err != nil {
+		return
+	}
+	return n + 4, nil
+}
+
+// writeEcmaArrayObject writes arr as an ECMA array. The count written is
+// arr.Count, or the number of properties if that is larger.
+func (e *Encoder) writeEcmaArrayObject(arr EcmaArray) (n int, err error) {
+	n, ok, err := e.writeReferenceKey(wrapperKey(reflect.ValueOf(arr), arr.Object))
+	if ok || err != nil {
+		return
+	}
+	count := arr.Count
+	if uint32(len(arr.Object)) > count {
+		count = uint32(len(arr.Object))
+	}
+	n, err = e.writeEcmaArrayHeader(count)
+	if err != nil {
+		return
+	}
+	v := reflect.ValueOf(arr.Object)
+	m, err := e.writeMapProperties(v, mapKeys(v))
+	return n + m, err
+}
+
+// writeOrderedEcmaArray writes arr as an ECMA array, with the properties in
+// order. The count written is arr.Count, or the number of properties if that
+// is larger.
+func (e *Encoder) writeOrderedEcmaArray(arr OrderedEcmaArray) (n int, err error) {
+	n, ok, err := e.writeReferenceKey(wrapperKey(reflect.ValueOf(arr), arr.Properties))
+	if ok || err != nil {
+		return
+	}
+	count := arr.Count
+	if uint32(len(arr.Properties)) > count {
+		count = uint32(len(arr.Properties))
+	}
+	n, err = e.writeEcmaArrayHeader(count)
+	if err != nil {
+		return
+	}
+	m, err := e.writeOrderedProperties(reflect.ValueOf(arr.Properties))
+	return n + m, err
+}
+
+// writeOrderedProperties writes the properties of the OrderedObject v in
+// order, followed by the object end marker.
+func (e *Encoder) writeOrderedProperties(v reflect.Value) (n int, err error) {
+	m := 0
+	for i := 0; i < v.Len(); i++ {
+		p := v.Index(i)
+		m, err = WriteObjectName(e.w, p.Field(0).String())
+		if err != nil {
+			return
+		}
+		n += m
+		m, err = e.writeValue(p.Field(1))
 		if err != nil {
 			return
 		}
 		n += m
 	}
-	m, err = WriteObjectEndMarker(w)
+	m, err = WriteObjectEndMarker(e.w)
+	return n + m, err
+}
+
+// writeMapProperties writes the entries of the map v in the order of keys,
+// followed by the object end marker.
+func (e *Encoder) writeMapProperties(v reflect.Value, keys []reflect.Value) (n int, err error) {
+	m := 0
+	for _, k := range keys {
+		m, err = WriteObjectName(e.w, k.String())
+		if err != nil {
+			return
+		}
+		n += m
+		m, err = e.writeValue(v.MapIndex(k))
+		if err != nil {
+			return
+		}
+		n += m
+	}
+	m, err = WriteObjectEndMarker(e.w)
 	return n + m, err
 }
 
@@ -150,90 +325,193 @@ func WriteObjectName(w Writer, name string) (n int, err error) {
 }
 
 func WriteObject(w Writer, obj Object) (n int, err error) {
-	n, err = WriteObjectMarker(w)
+	return NewEncoder(w, AMF0).writeObject(obj)
+}
+
+func (e *Encoder) writeObject(obj Object) (n int, err error) {
+	n, ok, err := e.writeReference(reflect.ValueOf(obj))
+	if ok || err != nil {
+		return
+	}
+	n, err = WriteObjectMarker(e.w)
 	if err != nil {
 		return
 	}
-	m := 0
-	for key, value := range obj {
-		m, err = WriteObjectName(w, key)
+	v := reflect.ValueOf(obj)
+	m, err := e.writeMapProperties(v, e.objectKeys(v))
+	return n + m, err
+}
+
+// WriteTypedObjectMarker writes the typed-object marker followed by the
+// class name. The properties and the object end marker follow it.
+func WriteTypedObjectMarker(w Writer, className string) (n int, err error) {
+	n, err = WriteMarker(w, Amf0TypedObjectMarker)
+	if err != nil {
+		return
+	}
+	m, err := WriteObjectName(w, className)
+	return n + m, err
+}
+
+func WriteTypedObject(w Writer, obj TypedObject) (n int, err error) {
+	return NewEncoder(w, AMF0).writeTypedObject(obj)
+}
+
+func (e *Encoder) writeTypedObject(obj TypedObject) (n int, err error) {
+	n, ok, err := e.writeReferenceKey(wrapperKey(reflect.ValueOf(obj), obj.Object))
+	if ok || err != nil {
+		return
+	}
+	n, err = WriteTypedObjectMarker(e.w, obj.ClassName)
+	if err != nil {
+		return
+	}
+	v := reflect.ValueOf(obj.Object)
+	m, err := e.writeMapProperties(v, e.objectKeys(v))
+	return n + m, err
+}
+
+func WriteStruct(w Writer, value reflect.Value) (n int, err error) {
+	return NewEncoder(w, AMF0).writeStruct(value)
+}
+
+func (e *Encoder) writeStruct(value reflect.Value) (n int, err error) {
+	var m int
+	for _, f := range structFields(value.Type()) {
+		field, ok := fieldByIndexNoAlloc(value, f.index)
+		if !ok || f.omitEmpty && isEmptyValue(field) {
+			continue
+		}
+		if str, ok := formatString(field); ok && f.asString {
+			field = reflect.ValueOf(str)
+		}
+		m, err = WriteObjectName(e.w, f.name)
 		if err != nil {
 			return
 		}
 		n += m
-		m, err = WriteValue(w, value)
+		m, err = e.writeValue(field)
 		if err != nil {
 			return
 		}
 		n += m
 	}
-	m, err = WriteObjectEndMarker(w)
+	return n, nil
+}
+
+// writeStructObject writes the struct v as a typed object if its type has a
+// class alias, otherwise as an anonymous object.
+func (e *Encoder) writeStructObject(v reflect.Value) (n int, err error) {
+	if className := classAlias(v.Type()); className != "" {
+		n, err = WriteTypedObjectMarker(e.w, className)
+	} else {
+		n, err = WriteObjectMarker(e.w)
+	}
+	if err != nil {
+		return
+	}
+	m, err := e.writeStruct(v)
+	if err != nil {
+		return
+	}
+	n += m
+	m, err = WriteObjectEndMarker(e.w)
 	return n + m, err
 }
 
-func WriteStruct(w Writer, value reflect.Value) (n int, err error) {
-	var m int
-	for i := 0; i < value.NumField(); i++ {
-		skip := false
-		structField := value.Type().Field(i)
-		if structField.Anonymous {
-			m, err = WriteStruct(w, value.Field(i))
-			if err != nil {
-				return
-			}
-			n += m
-		} else {
-			name := structField.Tag.Get("amf")
-			switch name {
-			case "":
-				name = structField.Name
-			case "-":
-				skip = true
-			default:
-				if strings.HasSuffix(name, ",omitempty") {
-					if value.IsNil() {
-						skip = true
-					}
-
-					name = strings.Split(name, ",")[0]
-					if len(name) == 0 {
-						name = structField.Name
-					}
-				}
-			}
-			if skip {
-				continue
-			}
-			m, err = WriteObjectName(w, name)
+// writeReference writes a reference-type if AMF0 references are enabled and
+// v has already been written in this message. Otherwise v is added to the
+// object table and the caller writes it inline.
+func (e *Encoder) writeReference(v reflect.Value) (n int, ok bool, err error) {
+	return e.writeReferenceKey(referenceKey(v))
+}
+
+func (e *Encoder) writeReferenceKey(key refKey, canRef bool) (n int, ok bool, err error) {
+	if !e.amf0References {
+		return 0, false, nil
+	}
+	if canRef {
+		if index, ok := e.amf0Objects[key]; ok {
+			n, err = WriteMarker(e.w, Amf0ReferenceMarker)
 			if err != nil {
-				return
+				return n, true, err
 			}
-			n += m
-			field := value.Field(i)
-			m, err = writeValue(w, field)
+			err = binary.Write(e.w, binary.BigEndian, uint16(index))
 			if err != nil {
-				return
+				return n, true, err
 			}
-			n += m
+			return n + 2, true, nil
+		}
+		// References are 16-bit, later objects are always written inline.
+		if e.amf0ObjectCount <= 0xFFFF {
+			e.amf0Objects[key] = e.amf0ObjectCount
 		}
 	}
-	return n, nil
+	e.amf0ObjectCount++
+	return 0, false, nil
 }
 
-func WriteValue(w Writer, value interface{}) (n int, err error) {
-	if value == nil {
-		return WriteNull(w)
+// WriteAvmplus writes value as AMF3 after the avmplus-object marker.
+func WriteAvmplus(w Writer, value interface{}) (n int, err error) {
+	return NewEncoder(w, AMF0).writeAvmplus(value)
+}
+
+func (e *Encoder) writeAvmplus(value interface{}) (n int, err error) {
+	n, err = WriteMarker(e.w, Amf0AvmplusObjectMarker)
+	if err != nil {
+		return
 	}
-	v := reflect.ValueOf(value)
-	if !v.IsValid() {
-		return WriteNull(w)
+	m, err := e.amf3WriteValue(value)
+	return n + m, err
+}
+
+// isAmf0Primitive reports whether v is written as an AMF0 number, boolean,
+// string, null or undefined.
+func isAmf0Primitive(v reflect.Value) bool {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return true
+		}
+		v = v.Elem()
 	}
-	return writeValue(w, v)
+	switch v.Kind() {
+	case reflect.Invalid, reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	case reflect.String:
+		return v.Type() != reflect.TypeOf(XMLDocument(""))
+	case reflect.Struct:
+		return v.Type() == reflect.TypeOf(Undefined{}) || v.Type() == reflect.TypeOf(Number{})
+	}
+	return false
 }
 
-func writeValue(w Writer, v reflect.Value) (n int, err error) {
+func WriteValue(w Writer, value interface{}) (n int, err error) {
+	return NewEncoder(w, AMF0).Encode(value)
+}
+
+func (e *Encoder) writeValue(v reflect.Value) (n int, err error) {
+	w := e.w
+	if !v.IsValid() {
+		return WriteNull(w)
+	}
+	if m, ok := marshaler(v); ok {
+		value, err := m.MarshalAMF(AMF0)
+		if err != nil {
+			return 0, err
+		}
+		r, self := selfMarshaled(reflect.ValueOf(value), v)
+		if !self {
+			return e.writeValue(r)
+		}
+		v = r
+	}
 	switch v.Kind() {
 	case reflect.String:
+		if v.Type() == reflect.TypeOf(XMLDocument("")) {
+			return WriteXMLDocument(w, XMLDocument(v.String()))
+		}
 		return WriteString(w, v.String())
 	case reflect.Bool:
 		return WriteBoolean(w, v.Bool())
@@ -246,31 +524,24 @@ func writeValue(w Writer, v reflect.Value) (n int, err error) {
 	case reflect.Array:
 		fallthrough
 	case reflect.Slice:
-		n, err = WriteMarker(w, Amf0EcmaArrayMarker)
-		if err != nil {
+		var ok bool
+		n, ok, err = e.writeReference(v)
+		if ok || err != nil {
 			return
 		}
-		length := int32(v.Len())
-		err = binary.Write(w, binary.BigEndian, &length)
-		if err != nil {
-			return
-		}
-		n += 4
-		m := 0
-		for index := int32(0); index < length; index++ {
-			m, err = WriteObjectName(w, fmt.Sprintf("%d", index))
-			if err != nil {
-				return
-			}
-			n += m
-			m, err = WriteValue(w, v.Index(int(index)).Interface())
+		if v.Type() == reflect.TypeOf(OrderedObject(nil)) {
+			n, err = WriteObjectMarker(w)
 			if err != nil {
 				return
 			}
-			n += m
+			m := 0
+			m, err = e.writeOrderedProperties(v)
+			return n + m, err
 		}
-		m, err = WriteObjectEndMarker(w)
-		return n + m, err
+		if e.ecmaArraySlices {
+			return e.writeSliceEcmaArray(v)
+		}
+		return e.writeSliceStrictArray(v)
 	case reflect.Map:
 		if v.Type().Key().Kind() != reflect.String {
 			return 0, &UnsupportedTypeError{v.Type().Name()}
@@ -278,54 +549,69 @@ func writeValue(w Writer, v reflect.Value) (n int, err error) {
 		if v.IsNil() {
 			return WriteNull(w)
 		}
-		n, err = WriteObjectMarker(w)
+		var ok bool
+		n, ok, err = e.writeReference(v)
+		if ok || err != nil {
+			return
+		}
+		if e.ecmaArray && v.Type() != reflect.TypeOf(Object(nil)) {
+			n, err = e.writeEcmaArrayHeader(uint32(v.Len()))
+		} else {
+			n, err = WriteObjectMarker(w)
+		}
 		if err != nil {
 			return
 		}
 		m := 0
-		var sv stringValues = v.MapKeys()
-		sort.Sort(sv)
-		for _, k := range sv {
-			m, err = WriteObjectName(w, k.String())
-			if err != nil {
-				return
-			}
-			n += m
-			m, err = WriteValue(w, v.MapIndex(k).Interface())
-			if err != nil {
-				return
-			}
-			n += m
-		}
-		m, err = WriteObjectEndMarker(w)
+		m, err = e.writeMapProperties(v, mapKeys(v))
 		return n + m, err
-	case reflect.Ptr:
-		if v.IsNil() || !v.IsValid() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
 			return WriteNull(w)
 		}
-		return WriteValue(w, v.Elem().Interface())
+		if v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Struct && !isValueType(v.Elem().Type()) {
+			var ok bool
+			n, ok, err = e.writeReference(v)
+			if ok || err != nil {
+				return
+			}
+			return e.writeStructObject(v.Elem())
+		}
+		return e.writeValue(v.Elem())
 	case reflect.Struct:
-		n, err = WriteObjectMarker(w)
-		if err != nil {
-			return
+		if v.CanInterface() {
+			switch vt := v.Interface().(type) {
+			case Undefined:
+				return WriteUndefined(w)
+			case TypedObject:
+				return e.writeTypedObject(vt)
+			case time.Time:
+				return WriteDate(w, vt)
+			case Date:
+				return WriteDateTimezone(w, vt)
+			case Number:
+				return WriteDouble(w, vt.Value)
+			case EcmaArray:
+				return e.writeEcmaArrayObject(vt)
+			case OrderedEcmaArray:
+				return e.writeOrderedEcmaArray(vt)
+			}
 		}
-		m := 0
-		m, err = WriteStruct(w, v)
-		if err != nil {
+		var ok bool
+		n, ok, err = e.writeReference(v)
+		if ok || err != nil {
 			return
 		}
-		n += m
-		m, err = WriteObjectEndMarker(w)
-		return n + m, err
+		return e.writeStructObject(v)
 	}
 	value := v.Interface()
 	if value != nil {
 		if _, ok := value.(Undefined); ok {
 			return WriteUndefined(w)
 		} else if vt, ok := value.(Object); ok {
-			return WriteObject(w, vt)
+			return e.writeObject(vt)
 		} else if vt, ok := value.([]interface{}); ok {
-			return WriteEcmaArray(w, vt)
+			return e.writeEcmaArray(vt)
 		}
 	}
 	return 0, &UnsupportedTypeError{v.Type().Name()}
@@ -360,8 +646,7 @@ func ReadUTF8(r Reader) (s string, err error) {
 	if stringLength == 0 {
 		return s, nil
 	}
-	data := make([]byte, stringLength)
-	_, err = r.Read(data)
+	data, err := readBytes(r, uint32(stringLength))
 	if err != nil {
 		return
 	}
@@ -377,8 +662,7 @@ func ReadUTF8Long(r Reader) (s string, err error) {
 	if stringLength == 0 {
 		return s, nil
 	}
-	data := make([]byte, stringLength)
-	_, err = r.Read(data)
+	data, err := readBytes(r, stringLength)
 	if err != nil {
 		return
 	}
@@ -425,14 +709,19 @@ func ReadObject(r Reader) (obj Object, err error) {
 }
 
 func ReadObjectProperty(r Reader) (Object, error) {
+	return NewDecoder(r, AMF0).readObjectProperty()
+}
+
+func (d *Decoder) readObjectProperty() (Object, error) {
 	obj := make(Object)
+	d.amf0Objects = append(d.amf0Objects, obj)
 	for {
-		name, err := ReadUTF8(r)
+		name, err := ReadUTF8(d.r)
 		if err != nil {
 			return nil, err
 		}
 		if name == "" {
-			b, err := r.ReadByte()
+			b, err := d.r.ReadByte()
 			if err != nil {
 				return nil, err
 			}
@@ -445,7 +734,7 @@ func ReadObjectProperty(r Reader) (Object, error) {
 		if _, ok := obj[name]; ok {
 			return nil, &PropertyExistError{name}
 		}
-		value, err := ReadValue(r)
+		value, err := d.readValue()
 		if err != nil {
 			return nil, err
 		}
@@ -454,55 +743,179 @@ func ReadObjectProperty(r Reader) (Object, error) {
 	return obj, nil
 }
 
+func ReadTypedObject(r Reader) (interface{}, error) {
+	return NewDecoder(r, AMF0).readTypedObject()
+}
+
+// readTypedObject reads a typed object after its marker. Objects of a class
+// registered with RegisterClassAlias are returned as the registered type,
+// others as TypedObject.
+func (d *Decoder) readTypedObject() (interface{}, error) {
+	className, err := ReadUTF8(d.r)
+	if err != nil {
+		return nil, err
+	}
+	index := len(d.amf0Objects)
+	obj, err := d.readObjectProperty()
+	if err != nil {
+		return nil, err
+	}
+	value, err := typedValue(TypedObject{ClassName: className, Object: obj}, AMF0)
+	if err != nil {
+		return nil, err
+	}
+	d.amf0Objects[index] = value
+	return value, nil
+}
+
+// readOrderedProperty reads the properties of an object, in order, up to the
+// object end marker.
+func (d *Decoder) readOrderedProperty() (OrderedObject, error) {
+	index := len(d.amf0Objects)
+	d.amf0Objects = append(d.amf0Objects, OrderedObject(nil))
+	var obj OrderedObject
+	names := make(map[string]bool)
+	for {
+		name, err := ReadUTF8(d.r)
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			b, err := d.r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if b == Amf0ObjectEndMarker {
+				break
+			} else {
+				return nil, &ExpectedTypeError{b}
+			}
+		}
+		if names[name] {
+			return nil, &PropertyExistError{name}
+		}
+		names[name] = true
+		value, err := d.readValue()
+		if err != nil {
+			return nil, err
+		}
+		obj = append(obj, Property{name, value})
+	}
+	d.amf0Objects[index] = obj
+	return obj, nil
+}
+
+func ReadEcmaArray(r Reader) (EcmaArray, error) {
+	return NewDecoder(r, AMF0).readEcmaArray()
+}
+
+// readEcmaArray reads an ECMA array after its marker.
+func (d *Decoder) readEcmaArray() (arr EcmaArray, err error) {
+	err = binary.Read(d.r, binary.BigEndian, &arr.Count)
+	if err != nil {
+		return arr, err
+	}
+	index := len(d.amf0Objects)
+	arr.Object, err = d.readObjectProperty()
+	if err != nil {
+		return arr, err
+	}
+	d.amf0Objects[index] = arr
+	return arr, nil
+}
+
+// readOrderedEcmaArray reads an ECMA array after its marker, keeping the
+// order of the properties.
+func (d *Decoder) readOrderedEcmaArray() (arr OrderedEcmaArray, err error) {
+	err = binary.Read(d.r, binary.BigEndian, &arr.Count)
+	if err != nil {
+		return arr, err
+	}
+	index := len(d.amf0Objects)
+	arr.Properties, err = d.readOrderedProperty()
+	if err != nil {
+		return arr, err
+	}
+	d.amf0Objects[index] = arr
+	return arr, nil
+}
+
 func ReadStrictArray(r Reader) (arr []interface{}, err error) {
+	return NewDecoder(r, AMF0).readStrictArray()
+}
+
+func (d *Decoder) readStrictArray() (arr []interface{}, err error) {
 	var arrayCount uint32
-	err = binary.Read(r, binary.BigEndian, &arrayCount)
+	err = binary.Read(d.r, binary.BigEndian, &arrayCount)
 	if err != nil {
 		return nil, err
 	}
-	if arrayCount == 0 {
-		return nil, nil
+	// An empty array is read as nil, but still takes its place in the
+	// reference table.
+	if arrayCount > 0 {
+		arr = make([]interface{}, preallocLen(arrayCount))
 	}
-	arr = make([]interface{}, arrayCount)
-
+	index := len(d.amf0Objects)
+	d.amf0Objects = append(d.amf0Objects, arr)
 	for i := uint32(0); i < arrayCount; i++ {
-		arr[i], err = ReadValue(r)
+		value, err := d.readValue()
 		if err != nil {
 			return nil, err
 		}
+		if int(i) < len(arr) {
+			arr[i] = value
+		} else {
+			arr = append(arr, value)
+		}
 	}
+	d.amf0Objects[index] = arr
 	return
 }
 
 func ReadDate(r Reader) (t time.Time, err error) {
-	var d float64
-	var timezone int16
-	err = binary.Read(r, binary.BigEndian, &d)
+	date, err := ReadDateTimezone(r)
+	return date.Time, err
+}
+
+// ReadDateTimezone reads a date-type after its marker, keeping the time zone
+// field.
+func ReadDateTimezone(r Reader) (date Date, err error) {
+	var ms float64
+	err = binary.Read(r, binary.BigEndian, &ms)
 	if err != nil {
-		return t, &ReadDateError{fmt.Sprintf("read double %s", err)}
+		return date, &ReadDateError{fmt.Sprintf("read double %s", err)}
 	}
-	err = binary.Read(r, binary.BigEndian, &timezone)
+	err = binary.Read(r, binary.BigEndian, &date.Timezone)
 	if err != nil {
-		return t, &ReadDateError{fmt.Sprintf("read time zone %s", err)}
+		return date, &ReadDateError{fmt.Sprintf("read time zone %s", err)}
 	}
-
-	d /= 1000.0
-	sec := int64(d)
-	nsec := int64((d - float64(sec)) * 10e9)
-	t = time.Unix(sec, nsec)
-	return
+	date.Time = time.UnixMilli(int64(ms))
+	return date, nil
 }
 
 func ReadValue(r Reader) (value interface{}, err error) {
-	marker, err := ReadMarker(r)
+	return NewDecoder(r, AMF0).Decode()
+}
+
+func (d *Decoder) readValue() (value interface{}, err error) {
+	marker, err := ReadMarker(d.r)
 	if err != nil {
 		return nil, err
 	}
+	return d.readMarkedValue(marker)
+}
+
+// readMarkedValue reads a value whose marker has already been read.
+func (d *Decoder) readMarkedValue(marker byte) (value interface{}, err error) {
+	r := d.r
 	switch marker {
 	case Amf0NumberMarker:
 		var num float64
 		err = binary.Read(r, binary.BigEndian, &num)
-		return num, err
+		if err != nil {
+			return nil, err
+		}
+		return d.number(num, false), nil
 	case Amf0BooleanMarker:
 		b, err := r.ReadByte()
 		if err != nil {
@@ -512,7 +925,10 @@ func ReadValue(r Reader) (value interface{}, err error) {
 	case Amf0StringMarker:
 		return ReadUTF8(r)
 	case Amf0ObjectMarker:
-		return ReadObjectProperty(r)
+		if d.orderedObjects {
+			return d.readOrderedProperty()
+		}
+		return d.readObjectProperty()
 	case Amf0MovieclipMarker:
 		return nil, &UnsupportedTypeError{"Movieclip"}
 	case Amf0NullMarker:
@@ -520,22 +936,28 @@ func ReadValue(r Reader) (value interface{}, err error) {
 	case Amf0UndefinedMarker:
 		return Undefined{}, nil
 	case Amf0EcmaArrayMarker:
-		// Decode ECMA Array to object
-		arrLen := make([]byte, 4)
-		_, err = r.Read(arrLen)
-		if err != nil {
-			return nil, err
+		if d.orderedObjects {
+			return d.readOrderedEcmaArray()
 		}
-		obj, err := ReadObjectProperty(r)
+		return d.readEcmaArray()
+	case Amf0ReferenceMarker:
+		var index uint16
+		err = binary.Read(r, binary.BigEndian, &index)
 		if err != nil {
 			return nil, err
 		}
-		return obj, nil
+		if int(index) >= len(d.amf0Objects) {
+			return nil, &ReferenceError{"object", uint32(index)}
+		}
+		return d.amf0Objects[index], nil
 	case Amf0ObjectEndMarker:
 		return nil, &UnexpectedTypeError{marker}
 	case Amf0StrictArrayMarker:
-		return ReadStrictArray(r)
+		return d.readStrictArray()
 	case Amf0DateMarker:
+		if d.dateTimezone {
+			return ReadDateTimezone(r)
+		}
 		return ReadDate(r)
 	case Amf0LongStringMarker:
 		return ReadUTF8Long(r)
@@ -544,11 +966,15 @@ func ReadValue(r Reader) (value interface{}, err error) {
 	case Amf0RecordsetMarker:
 		return nil, &UnexpectedTypeError{marker}
 	case Amf0XMLDocumentMarker:
-		return nil, &UnexpectedTypeError{marker}
+		doc, err := ReadUTF8Long(r)
+		if err != nil {
+			return nil, err
+		}
+		return XMLDocument(doc), nil
 	case Amf0TypedObjectMarker:
-		return nil, &UnexpectedTypeError{marker}
+		return d.readTypedObject()
 	case Amf0AvmplusObjectMarker:
-		return Amf3ReadValue(r)
+		return d.amf3ReadValue()
 	}
 	return nil, &UnsupportedTypeError{string(marker)}
 }
@@ -6,7 +6,10 @@ package goamf
 import (
 	"bytes"
 	"encoding/binary"
+	"io"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestWriteMarker(t *testing.T) {
@@ -272,12 +275,11 @@ var testCases = []TestEncodeValueCase{
 	{"true", true, []byte{0x01, 0x01}},
 	{"null", nil, []byte{0x05}},
 	{"array", []string{"a", "b", "c"},
-		[]byte{0x08,
+		[]byte{0x0a,
 			0x00, 0x00, 0x00, 0x03,
-			0x00, 0x01, '0', 0x02, 0x00, 0x01, 'a',
-			0x00, 0x01, '1', 0x02, 0x00, 0x01, 'b',
-			0x00, 0x01, '2', 0x02, 0x00, 0x01, 'c',
-			0x00, 0x00, 0x09,
+			0x02, 0x00, 0x01, 'a',
+			0x02, 0x00, 0x01, 'b',
+			0x02, 0x00, 0x01, 'c',
 		}},
 	{"struct", &Struct{Embedded{"emb"}, "zhang", &SubStruct{"123"}, "noname", "unused"},
 		[]byte{0x03,
@@ -289,15 +291,13 @@ var testCases = []TestEncodeValueCase{
 			0x00, 0x05, 'E', 'm', 'p', 't', 'y', 0x02, 0x00, 0x06, 'n', 'o', 'n', 'a', 'm', 'e', // Empty: noname
 			0x00, 0x00, 0x09,
 		}},
-	/*
-		{"object", Object{"0": "a", "1": "b", "2": "c"},
-			[]byte{0x03,
-				0x00, 0x01, '1', 0x02, 0x00, 0x01, 'b',
-				0x00, 0x01, '0', 0x02, 0x00, 0x01, 'a',
-				0x00, 0x01, '2', 0x02, 0x00, 0x01, 'c',
-				0x00, 0x00, 0x09,
-			}},
-	*/
+	{"object", Object{"0": "a", "1": "b", "2": "c"},
+		[]byte{0x03,
+			0x00, 0x01, '0', 0x02, 0x00, 0x01, 'a',
+			0x00, 0x01, '1', 0x02, 0x00, 0x01, 'b',
+			0x00, 0x01, '2', 0x02, 0x00, 0x01, 'c',
+			0x00, 0x00, 0x09,
+		}},
 	{"Map", map[string]string{"0": "a", "1": "b", "2": "c"},
 		[]byte{0x03,
 			0x00, 0x01, '0', 0x02, 0x00, 0x01, 'a',
@@ -509,3 +509,358 @@ func TestDecodeObject(t *testing.T) {
 		t.Errorf("ReadObject loss some items: %v", expect)
 	}
 }
+
+func TestDecodeReference(t *testing.T) {
+	buf := bytes.NewReader([]byte{
+		0x0a, 0x00, 0x00, 0x00, 0x02,
+		0x03, 0x00, 0x01, 'a', 0x00, 0x3f, 0xf0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x09,
+		0x07, 0x00, 0x01,
+	})
+	got, err := ReadValue(buf)
+	if err != nil {
+		t.Fatalf("ReadValue error: %s", err)
+	}
+	arr, ok := got.([]interface{})
+	if !ok || len(arr) != 2 {
+		t.Fatalf("ReadValue expect array of 2 got %#v", got)
+	}
+	first, _ := arr[0].(Object)
+	second, _ := arr[1].(Object)
+	if first == nil || reflect.ValueOf(first).Pointer() != reflect.ValueOf(second).Pointer() {
+		t.Errorf("ReadValue expect shared object got %#v", arr)
+	}
+
+	_, err = ReadValue(bytes.NewReader([]byte{0x07, 0x00, 0x00}))
+	if _, ok := err.(*ReferenceError); !ok {
+		t.Errorf("ReadValue expect ReferenceError got %v", err)
+	}
+}
+
+func TestReadEmptyStrictArray(t *testing.T) {
+	got, err := ReadValue(bytes.NewReader([]byte{
+		0x0a, 0x00, 0x00, 0x00, 0x02,
+		0x0a, 0x00, 0x00, 0x00, 0x00,
+		0x07, 0x00, 0x01, // the empty array by reference
+	}))
+	if err != nil {
+		t.Fatalf("ReadValue error: %s", err)
+	}
+	expect := []interface{}{[]interface{}(nil), []interface{}(nil)}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("ReadValue expect %#v got %#v", expect, got)
+	}
+}
+
+func TestReadStrictArrayLength(t *testing.T) {
+	_, err := ReadValue(bytes.NewReader([]byte{0x0a, 0xff, 0xff, 0xff, 0xff, 0x05}))
+	if err == nil {
+		t.Errorf("ReadValue expect error for truncated strict array")
+	}
+}
+
+func TestEncodeReference(t *testing.T) {
+	obj := Object{"a": 1.0}
+	buf := new(bytes.Buffer)
+	e := NewEncoder(buf, AMF0)
+	e.SetAmf0References(true)
+	_, err := e.Encode([]interface{}{obj, obj})
+	if err != nil {
+		t.Fatalf("Encode error: %s", err)
+	}
+	expect := []byte{
+		0x0a, 0x00, 0x00, 0x00, 0x02,
+		0x03, 0x00, 0x01, 'a', 0x00, 0x3f, 0xf0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x09,
+		0x07, 0x00, 0x01,
+	}
+	if !bytes.Equal(buf.Bytes(), expect) {
+		t.Errorf("Encode expect %x got %x", expect, buf.Bytes())
+	}
+
+	buf.Reset()
+	_, err = WriteValue(buf, []interface{}{obj, obj})
+	if err != nil {
+		t.Fatalf("WriteValue error: %s", err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte{0x07, 0x00, 0x01}) {
+		t.Errorf("WriteValue expect no reference got %x", buf.Bytes())
+	}
+}
+
+func TestXMLDocument(t *testing.T) {
+	buf := new(bytes.Buffer)
+	n, err := WriteValue(buf, XMLDocument("<a/>"))
+	if err != nil {
+		t.Fatalf("WriteValue error: %s", err)
+	}
+	expect := []byte{0x0f, 0x00, 0x00, 0x00, 0x04, '<', 'a', '/', '>'}
+	if !bytes.Equal(buf.Bytes(), expect) || n != len(expect) {
+		t.Errorf("WriteValue expect %x got %x, n: %d", expect, buf.Bytes(), n)
+	}
+
+	value, err := ReadValue(bytes.NewReader(expect))
+	if err != nil {
+		t.Fatalf("ReadValue error: %s", err)
+	}
+	if value != XMLDocument("<a/>") {
+		t.Errorf("ReadValue expect %#v got %#v", XMLDocument("<a/>"), value)
+	}
+
+	// A document shorter than its length, or with a length of 4 GB and no
+	// data, fails instead of being padded or allocated.
+	for _, data := range [][]byte{expect[:7], {0x0f, 0xff, 0xff, 0xff, 0xff, '<'}} {
+		_, err = ReadValue(bytes.NewReader(data))
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("ReadValue expect ErrUnexpectedEOF for %x got %v", data, err)
+		}
+	}
+}
+
+func TestWriteDate(t *testing.T) {
+	buf := new(bytes.Buffer)
+	n, err := WriteValue(buf, time.UnixMilli(1500))
+	if err != nil {
+		t.Fatalf("WriteValue error: %s", err)
+	}
+	expect := []byte{0x0b, 0x40, 0x97, 0x70, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	if !bytes.Equal(buf.Bytes(), expect) || n != len(expect) {
+		t.Errorf("WriteValue expect %x got %x, n: %d", expect, buf.Bytes(), n)
+	}
+
+	buf.Reset()
+	date := Date{time.UnixMilli(1500), -480}
+	_, err = WriteValue(buf, &date)
+	if err != nil {
+		t.Fatalf("WriteValue error: %s", err)
+	}
+	expect = []byte{0x0b, 0x40, 0x97, 0x70, 0x00, 0x00, 0x00, 0x00, 0x00, 0xfe, 0x20}
+	if !bytes.Equal(buf.Bytes(), expect) {
+		t.Errorf("WriteValue expect %x got %x", expect, buf.Bytes())
+	}
+
+	value, err := ReadValue(bytes.NewReader(expect))
+	if err != nil {
+		t.Fatalf("ReadValue error: %s", err)
+	}
+	if tm, ok := value.(time.Time); !ok || !tm.Equal(date.Time) {
+		t.Errorf("ReadValue expect %v got %v", date.Time, value)
+	}
+
+	dec := NewDecoder(bytes.NewReader(expect), AMF0)
+	dec.SetDateTimezone(true)
+	value, err = dec.Decode()
+	if err != nil {
+		t.Fatalf("Decode error: %s", err)
+	}
+	got, ok := value.(Date)
+	if !ok || !got.Time.Equal(date.Time) || got.Timezone != date.Timezone {
+		t.Errorf("Decode expect %v got %v", date, value)
+	}
+}
+
+func TestReadDate(t *testing.T) {
+	buf := bytes.NewReader([]byte{0x40, 0x97, 0x70, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00})
+	got, err := ReadDate(buf)
+	if err != nil {
+		t.Fatalf("ReadDate error: %s", err)
+	}
+	if got.UnixNano() != 1500*int64(time.Millisecond) {
+		t.Errorf("ReadDate expect 1.5s got %d", got.UnixNano())
+	}
+
+	var tm time.Time
+	err = Unmarshal([]byte{0x0b, 0x40, 0x97, 0x70, 0x00, 0x00, 0x00, 0x00, 0x00, 0xfe, 0x20}, AMF0, &tm)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %s", err)
+	}
+	if tm.UnixMilli() != 1500 {
+		t.Errorf("Unmarshal expect 1500ms got %d", tm.UnixMilli())
+	}
+}
+
+func TestWriteEcmaArray(t *testing.T) {
+	buf := new(bytes.Buffer)
+	n, err := WriteEcmaArray(buf, []interface{}{"a", true})
+	if err != nil {
+		t.Fatalf("WriteEcmaArray error: %s", err)
+	}
+	expect := []byte{0x08, 0x00, 0x00, 0x00, 0x02,
+		0x00, 0x01, '0', 0x02, 0x00, 0x01, 'a',
+		0x00, 0x01, '1', 0x01, 0x01,
+		0x00, 0x00, 0x09,
+	}
+	if !bytes.Equal(buf.Bytes(), expect) || n != len(expect) {
+		t.Errorf("WriteEcmaArray expect %x got %x, n: %d", expect, buf.Bytes(), n)
+	}
+
+	buf.Reset()
+	e := NewEncoder(buf, AMF0)
+	e.SetEcmaArray(true)
+	_, err = e.Encode(map[string]interface{}{"duration": 1})
+	if err != nil {
+		t.Fatalf("Encode error: %s", err)
+	}
+	expect = []byte{0x08, 0x00, 0x00, 0x00, 0x01,
+		0x00, 0x08, 'd', 'u', 'r', 'a', 't', 'i', 'o', 'n', 0x00, 0x3f, 0xf0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x09,
+	}
+	if !bytes.Equal(buf.Bytes(), expect) {
+		t.Errorf("Encode expect %x got %x", expect, buf.Bytes())
+	}
+}
+
+func TestReadEcmaArray(t *testing.T) {
+	data := []byte{0x08, 0x00, 0x00, 0x00, 0x05,
+		0x00, 0x01, 'a', 0x01, 0x01,
+		0x00, 0x00, 0x09,
+	}
+	value, err := ReadValue(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadValue error: %s", err)
+	}
+	expect := EcmaArray{5, Object{"a": true}}
+	if !reflect.DeepEqual(value, expect) {
+		t.Errorf("ReadValue expect %#v got %#v", expect, value)
+	}
+
+	buf := new(bytes.Buffer)
+	_, err = WriteValue(buf, value)
+	if err != nil {
+		t.Fatalf("WriteValue error: %s", err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("WriteValue expect %x got %x", data, buf.Bytes())
+	}
+}
+
+func TestEcmaArraySlices(t *testing.T) {
+	buf := new(bytes.Buffer)
+	e := NewEncoder(buf, AMF0)
+	e.SetEcmaArraySlices(true)
+	n, err := e.Encode([]string{"a", "b"})
+	if err != nil {
+		t.Fatalf("Encode error: %s", err)
+	}
+	expect := []byte{0x08, 0x00, 0x00, 0x00, 0x02,
+		0x00, 0x01, '0', 0x02, 0x00, 0x01, 'a',
+		0x00, 0x01, '1', 0x02, 0x00, 0x01, 'b',
+		0x00, 0x00, 0x09,
+	}
+	if !bytes.Equal(buf.Bytes(), expect) || n != len(expect) {
+		t.Errorf("Encode expect %x got %x, n: %d", expect, buf.Bytes(), n)
+	}
+}
+
+func TestOrderedObject(t *testing.T) {
+	obj := OrderedObject{{"b", true}, {"a", nil}}
+	buf := new(bytes.Buffer)
+	n, err := WriteValue(buf, obj)
+	if err != nil {
+		t.Fatalf("WriteValue error: %s", err)
+	}
+	expect := []byte{0x03,
+		0x00, 0x01, 'b', 0x01, 0x01,
+		0x00, 0x01, 'a', 0x05,
+		0x00, 0x00, 0x09,
+	}
+	if !bytes.Equal(buf.Bytes(), expect) || n != len(expect) {
+		t.Errorf("WriteValue expect %x got %x, n: %d", expect, buf.Bytes(), n)
+	}
+
+	d := NewDecoder(bytes.NewReader(expect), AMF0)
+	d.SetOrderedObjects(true)
+	value, err := d.Decode()
+	if err != nil {
+		t.Fatalf("Decode error: %s", err)
+	}
+	if !reflect.DeepEqual(value, obj) {
+		t.Errorf("Decode expect %#v got %#v", obj, value)
+	}
+}
+
+func TestOrderedEcmaArray(t *testing.T) {
+	data := []byte{0x08, 0x00, 0x00, 0x00, 0x02,
+		0x00, 0x05, 'w', 'i', 'd', 't', 'h', 0x00, 0x3f, 0xf0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x06, 'h', 'e', 'i', 'g', 'h', 't', 0x00, 0x3f, 0xf0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x09,
+	}
+	d := NewDecoder(bytes.NewReader(data), AMF0)
+	d.SetOrderedObjects(true)
+	value, err := d.Decode()
+	if err != nil {
+		t.Fatalf("Decode error: %s", err)
+	}
+	expect := OrderedEcmaArray{2, OrderedObject{{"width", 1.0}, {"height", 1.0}}}
+	if !reflect.DeepEqual(value, expect) {
+		t.Errorf("Decode expect %#v got %#v", expect, value)
+	}
+
+	buf := new(bytes.Buffer)
+	_, err = WriteValue(buf, value)
+	if err != nil {
+		t.Fatalf("WriteValue error: %s", err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("WriteValue expect %x got %x", data, buf.Bytes())
+	}
+}
+
+func TestWriteObjectSorted(t *testing.T) {
+	obj := Object{"c": 1, "a": Object{"z": true, "y": false}, "b": "x"}
+	expect := []byte{0x03,
+		0x00, 0x01, 'a', 0x03,
+		0x00, 0x01, 'y', 0x01, 0x00,
+		0x00, 0x01, 'z', 0x01, 0x01,
+		0x00, 0x00, 0x09,
+		0x00, 0x01, 'b', 0x02, 0x00, 0x01, 'x',
+		0x00, 0x01, 'c', 0x00, 0x3f, 0xf0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x09,
+	}
+	for i := 0; i < 10; i++ {
+		buf := new(bytes.Buffer)
+		_, err := WriteValue(buf, obj)
+		if err != nil {
+			t.Fatalf("WriteValue error: %s", err)
+		}
+		if !bytes.Equal(buf.Bytes(), expect) {
+			t.Fatalf("WriteValue expect %x got %x", expect, buf.Bytes())
+		}
+
+		// WriteObject itself only sorts when deterministic.
+		buf.Reset()
+		enc := NewEncoder(buf, AMF0)
+		enc.SetDeterministic(true)
+		_, err = enc.writeObject(obj)
+		if err != nil {
+			t.Fatalf("WriteObject error: %s", err)
+		}
+		if !bytes.Equal(buf.Bytes(), expect) {
+			t.Fatalf("WriteObject expect %x got %x", expect, buf.Bytes())
+		}
+	}
+}
+
+func TestWriteValuePointer(t *testing.T) {
+	values := []interface{}{
+		TypedObject{ClassName: "a.B", Object: Object{"x": "y"}},
+		EcmaArray{Count: 1, Object: Object{"x": 1}},
+		Number{Value: 2},
+		Undefined{},
+	}
+	for _, v := range values {
+		expect := new(bytes.Buffer)
+		if _, err := WriteValue(expect, v); err != nil {
+			t.Fatalf("WriteValue %T error: %s", v, err)
+		}
+		p := reflect.New(reflect.TypeOf(v))
+		p.Elem().Set(reflect.ValueOf(v))
+		buf := new(bytes.Buffer)
+		if _, err := WriteValue(buf, p.Interface()); err != nil {
+			t.Fatalf("WriteValue *%T error: %s", v, err)
+		}
+		if !bytes.Equal(buf.Bytes(), expect.Bytes()) {
+			t.Errorf("WriteValue *%T expect %x got %x", v, expect.Bytes(), buf.Bytes())
+		}
+	}
+}
@@ -8,8 +8,24 @@ import (
 	"fmt"
 	"reflect"
 	"sort"
+	"time"
 )
 
+// amf3Traits describes the class of an AMF3 object.
+type amf3Traits struct {
+	className      string
+	members        []string
+	dynamic        bool
+	externalizable bool
+}
+
+// key identifies the traits in the encoder's traits reference table. The
+// class and member names are quoted, so names holding separators can not
+// make two different traits share a key.
+func (t *amf3Traits) key() string {
+	return fmt.Sprintf("%q|%t|%t|%q", t.className, t.dynamic, t.externalizable, t.members)
+}
+
 // AMF3 write functions
 
 // Amf3WriteU29 writes a U29
@@ -95,6 +111,46 @@ func Amf3WriteUTF8(w Writer, str string) (n int, err error) {
 	return m + n, nil
 }
 
+// amf3WriteString writes a string-type, using the string reference table.
+func (e *Encoder) amf3WriteString(str string) (n int, err error) {
+	err = e.w.WriteByte(Amf3StringMarker)
+	if err != nil {
+		return 0, err
+	}
+	n, err = e.amf3WriteUTF8(str)
+	if err != nil {
+		return 1, err
+	}
+	return 1 + n, err
+}
+
+// amf3WriteUTF8 writes str as UTF-8-vr. A string that has been written before
+// in the same message is sent as a U29S-ref to the string reference table.
+func (e *Encoder) amf3WriteUTF8(str string) (n int, err error) {
+	if str == "" {
+		return Amf3WriteUTF8(e.w, str)
+	}
+	if index, ok := e.strings[str]; ok {
+		return Amf3WriteU29(e.w, uint32(index<<1))
+	}
+	e.strings[str] = len(e.strings)
+	return Amf3WriteUTF8(e.w, str)
+}
+
+// Amf3WriteInteger writes an integer-type. num must be in the signed 29-bit
+// range Amf3IntegerMin to Amf3IntegerMax.
+func Amf3WriteInteger(w Writer, num int32) (n int, err error) {
+	if num < Amf3IntegerMin || num > Amf3IntegerMax {
+		return 0, &OutOfRangeError{}
+	}
+	err = w.WriteByte(Amf3IntegerMarker)
+	if err != nil {
+		return 0, err
+	}
+	n, err = Amf3WriteU29(w, uint32(num)&0x1FFFFFFF)
+	return n + 1, err
+}
+
 func Amf3WriteDouble(w Writer, num float64) (n int, err error) {
 	err = w.WriteByte(Amf3DoubleMarker)
 	if err != nil {
@@ -107,6 +163,47 @@ func Amf3WriteDouble(w Writer, num float64) (n int, err error) {
 	return 9, nil
 }
 
+func Amf3WriteDate(w Writer, t time.Time) (n int, err error) {
+	return NewEncoder(w, AMF3).amf3WriteDate(refKey{}, false, t)
+}
+
+// amf3WriteDate writes a date-type as milliseconds since the epoch.
+func (e *Encoder) amf3WriteDate(key refKey, canRef bool, t time.Time) (n int, err error) {
+	n, err = WriteMarker(e.w, Amf3DateMarker)
+	if err != nil {
+		return
+	}
+	m, ok, err := e.amf3WriteReferenceKey(key, canRef)
+	n += m
+	if ok || err != nil {
+		return
+	}
+	err = e.w.WriteByte(0x01) // U29D-value
+	if err != nil {
+		return
+	}
+	err = binary.Write(e.w, binary.BigEndian, float64(t.UnixMilli()))
+	if err != nil {
+		return n + 1, err
+	}
+	return n + 9, nil
+}
+
+// amf3WriteXML writes an xml-type or xml-doc-type, depending on marker.
+func (e *Encoder) amf3WriteXML(marker byte, str string) (n int, err error) {
+	n, err = WriteMarker(e.w, marker)
+	if err != nil {
+		return
+	}
+	m, _, err := e.amf3WriteReferenceKey(refKey{}, false)
+	if err != nil {
+		return
+	}
+	n += m
+	m, err = Amf3WriteUTF8(e.w, str)
+	return n + m, err
+}
+
 func Amf3WriteBoolean(w Writer, b bool) (n int, err error) {
 	if b {
 		err = w.WriteByte(Amf3TrueMarker)
@@ -152,285 +249,1221 @@ func Amf3WriteObjectName(w Writer, name string) (n int, err error) {
 }
 
 func Amf3WriteObject(w Writer, obj Object) (n int, err error) {
-	n, err = Amf3WriteObjectMarker(w)
+	return NewEncoder(w, AMF3).amf3WriteObject(obj)
+}
+
+func (e *Encoder) amf3WriteObject(obj Object) (n int, err error) {
+	v := reflect.ValueOf(obj)
+	return e.amf3WriteMap(v, e.objectKeys(v))
+}
+
+// amf3WriteMap writes the entries of v in the order of keys as the dynamic
+// members of an anonymous object.
+func (e *Encoder) amf3WriteMap(v reflect.Value, keys []reflect.Value) (n int, err error) {
+	n, err = Amf3WriteObjectMarker(e.w)
 	if err != nil {
 		return
 	}
-	m := 0
-	err = w.WriteByte(0x0b) // traits class
-	if err != nil {
+	m, ok, err := e.amf3WriteReference(v)
+	n += m
+	if ok || err != nil {
 		return
 	}
-	n += 1
-	// Write empty class name
-	m, err = Amf3WriteUTF8(w, "")
+	m, err = e.amf3WriteTraits(&amf3Traits{dynamic: true})
 	if err != nil {
 		return
 	}
 	n += m
-	for key, value := range obj {
-		m, err = Amf3WriteObjectName(w, key)
+	for _, k := range keys {
+		m, err = e.amf3WriteUTF8(k.String())
 		if err != nil {
 			return
 		}
 		n += m
-		m, err = Amf3WriteValue(w, value)
+		m, err = e.amf3WriteValue(v.MapIndex(k).Interface())
 		if err != nil {
 			return
 		}
 		n += m
 	}
-	m, err = Amf3WriteObjectEndMarker(w)
+	m, err = Amf3WriteObjectEndMarker(e.w)
 	return n + m, err
 }
 
-func Amf3WriteValue(w Writer, value interface{}) (n int, err error) {
-	if value == nil {
-		return Amf3WriteNull(w)
+// amf3WriteOrderedObject writes the properties of obj in order as the
+// dynamic members of an anonymous object.
+func (e *Encoder) amf3WriteOrderedObject(obj OrderedObject) (n int, err error) {
+	n, err = Amf3WriteObjectMarker(e.w)
+	if err != nil {
+		return
 	}
-	v := reflect.ValueOf(value)
-	if !v.IsValid() {
-		return Amf3WriteNull(w)
+	m, ok, err := e.amf3WriteReference(reflect.ValueOf(obj))
+	n += m
+	if ok || err != nil {
+		return
 	}
-	switch v.Kind() {
-	case reflect.String:
-		return Amf3WriteString(w, v.String())
-	case reflect.Bool:
-		return Amf3WriteBoolean(w, v.Bool())
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		return Amf3WriteDouble(w, float64(v.Int()))
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		return Amf3WriteDouble(w, float64(v.Uint()))
-	case reflect.Float32, reflect.Float64:
-		return Amf3WriteDouble(w, v.Float())
-	case reflect.Array:
-		fallthrough
-	case reflect.Slice:
-		if v.Type().Elem().Kind() == reflect.Uint8 {
-			// Byte array
-			n, err = WriteMarker(w, Amf3ByteArrayMarker)
-			if err != nil {
-				return
-			}
-			b := v.Bytes()
-			length := len(b)
-			u := uint32((length << 1) | 0x01)
-			var m int
-			m, err = Amf3WriteU29(w, u)
-			if err != nil {
-				return
-			}
-			n += m
-			m, err = w.Write(b)
-			if err != nil {
-				return
-			}
-			n += m
-			return
-		} else {
-			n, err = WriteMarker(w, Amf3ArrayMarker)
-			if err != nil {
-				return
-			}
-			length := v.Len()
-			u := uint32((length << 1) | 0x01)
-			var m int
-			m, err = Amf3WriteU29(w, u)
-			if err != nil {
-				return
-			}
-			n += m
-			err = w.WriteByte(0x01) // empty string
-			if err != nil {
-				return
-			}
-			n += 1
-			for i := 0; i < length; i++ {
-				m, err = Amf3WriteValue(w, v.Index(i).Interface())
-				if err != nil {
-					return
-				}
-				n += m
-			}
-			return
-		}
-	case reflect.Map:
-		if v.Type().Key().Kind() != reflect.String {
-			return 0, &UnsupportedTypeError{v.Type().Key().Kind().String()}
-		}
-		n, err = Amf3WriteObjectMarker(w)
+	m, err = e.amf3WriteTraits(&amf3Traits{dynamic: true})
+	if err != nil {
+		return
+	}
+	n += m
+	for _, p := range obj {
+		m, err = e.amf3WriteUTF8(p.Name)
 		if err != nil {
 			return
 		}
-		m := 0
-		err = w.WriteByte(0x0b) // traits class
+		n += m
+		m, err = e.amf3WriteValue(p.Value)
 		if err != nil {
 			return
 		}
-		n += 1
-		// Write empty class name
-		m, err = Amf3WriteUTF8(w, "")
+		n += m
+	}
+	m, err = Amf3WriteObjectEndMarker(e.w)
+	return n + m, err
+}
+
+// amf3WriteTypedObject writes the properties of obj with the traits recorded
+// in obj.Sealed and obj.Dynamic, or as the sealed members of its class if
+// there are none.
+func (e *Encoder) amf3WriteTypedObject(key refKey, canRef bool, obj TypedObject) (n int, err error) {
+	n, err = Amf3WriteObjectMarker(e.w)
+	if err != nil {
+		return
+	}
+	m, ok, err := e.amf3WriteReferenceKey(key, canRef)
+	n += m
+	if ok || err != nil {
+		return
+	}
+	traits := &amf3Traits{className: obj.ClassName, members: obj.Sealed, dynamic: obj.Dynamic}
+	if obj.Sealed == nil && !obj.Dynamic {
+		traits.members = make([]string, 0, len(obj.Object))
+		for name := range obj.Object {
+			traits.members = append(traits.members, name)
+		}
+		e.sortNames(traits.members)
+	}
+	m, err = e.amf3WriteTraits(traits)
+	if err != nil {
+		return
+	}
+	n += m
+	sealed := make(map[string]struct{}, len(traits.members))
+	for _, name := range traits.members {
+		sealed[name] = struct{}{}
+		m, err = e.amf3WriteValue(obj.Object[name])
 		if err != nil {
 			return
 		}
 		n += m
-		var sv stringValues = v.MapKeys()
-		sort.Sort(sv)
-		for _, k := range sv {
-			m, err = Amf3WriteObjectName(w, k.String())
-			if err != nil {
-				return
-			}
-			n += m
-			m, err = Amf3WriteValue(w, v.MapIndex(k).Interface())
-			if err != nil {
-				return
-			}
-			n += m
-		}
-		m, err = Amf3WriteObjectEndMarker(w)
-		return n + m, err
 	}
-	if _, ok := value.(Undefined); ok {
-		return Amf3WriteUndefined(w)
-	} else if vt, ok := value.(Object); ok {
-		return Amf3WriteObject(w, vt)
-	} else if vt, ok := value.([]interface{}); ok {
-		return 0, &UnsupportedTypeError{fmt.Sprintf("%+v", vt)}
+	if !traits.dynamic {
+		return n, nil
 	}
-	return 0, &UnsupportedTypeError{v.Kind().String()}
-}
-
-// AMF3 write functions
-
-func Amf3ReadU29(r Reader) (n uint32, err error) {
-	var b byte
-	for i := 0; i < 3; i++ {
-		b, err = r.ReadByte()
+	names := make([]string, 0, len(obj.Object))
+	for name := range obj.Object {
+		if _, ok := sealed[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	e.sortNames(names)
+	for _, name := range names {
+		m, err = e.amf3WriteUTF8(name)
 		if err != nil {
 			return
 		}
-		n = (n << 7) + uint32(b&0x7f)
-		if (b & 0x80) == 0 {
+		n += m
+		m, err = e.amf3WriteValue(obj.Object[name])
+		if err != nil {
 			return
 		}
+		n += m
 	}
-	b, err = r.ReadByte()
-	if err != nil {
-		return
-	}
-	return (n << 8) + uint32(b), nil
+	m, err = Amf3WriteObjectEndMarker(e.w)
+	return n + m, err
 }
 
-func Amf3ReadUTF8(r Reader) (string, error) {
-	var length uint32
-	var err error
-	length, err = Amf3ReadU29(r)
+// amf3WriteExternalizable writes an externalizable object of className whose
+// body is written by write.
+func (e *Encoder) amf3WriteExternalizable(key refKey, canRef bool, className string, write func() (int, error)) (n int, err error) {
+	n, err = Amf3WriteObjectMarker(e.w)
 	if err != nil {
-		return "", err
-	}
-	if length&uint32(0x01) != uint32(0x01) {
-		return "", &UnsupportedTypeError{"AMF3 string reference"}
+		return
 	}
-	length = length >> 1
-	if length == 0 {
-		return "", nil
+	m, ok, err := e.amf3WriteReferenceKey(key, canRef)
+	n += m
+	if ok || err != nil {
+		return
 	}
-	data := make([]byte, length)
-	_, err = r.Read(data)
+	m, err = e.amf3WriteTraits(&amf3Traits{className: className, externalizable: true})
 	if err != nil {
-		return "", err
+		return
 	}
-	return string(data), nil
+	n += m
+	m, err = write()
+	return n + m, err
 }
 
-func Amf3ReadString(r Reader) (str string, err error) {
-	marker, err := ReadMarker(r)
+// amf3WriteStruct writes the exported fields of a struct, or a pointer to a
+// struct, as the sealed members of its class if the type has a class alias,
+// otherwise as the dynamic members of an anonymous object.
+func (e *Encoder) amf3WriteStruct(v reflect.Value) (n int, err error) {
+	n, err = Amf3WriteObjectMarker(e.w)
 	if err != nil {
-		return "", err
+		return
 	}
-	if marker != Amf3StringMarker {
-		return "", &UnexpectedTypeError{marker}
+	m, ok, err := e.amf3WriteReference(v)
+	n += m
+	if ok || err != nil {
+		return
 	}
-	return Amf3ReadUTF8(r)
-}
-
-func Amf3ReadInteger(r Reader) (num uint32, err error) {
-	marker, err := ReadMarker(r)
-	if err != nil {
-		return 0, err
+	v = reflect.Indirect(v)
+	var names []string
+	var values []interface{}
+	for _, f := range structFields(v.Type()) {
+		field, ok := fieldByIndexNoAlloc(v, f.index)
+		if !ok || !field.CanInterface() || f.omitEmpty && isEmptyValue(field) {
+			continue
+		}
+		names = append(names, f.name)
+		if str, ok := formatString(field); ok && f.asString {
+			values = append(values, str)
+		} else {
+			values = append(values, field.Interface())
+		}
 	}
-	if marker != Amf3IntegerMarker {
-		return 0, &UnexpectedTypeError{marker}
+	className := classAlias(v.Type())
+	if className != "" {
+		m, err = e.amf3WriteTraits(&amf3Traits{className: className, members: names})
+	} else {
+		m, err = e.amf3WriteTraits(&amf3Traits{dynamic: true})
 	}
-	return Amf3ReadU29(r)
-}
-
-func Amf3ReadDouble(r Reader) (num float64, err error) {
-	marker, err := ReadMarker(r)
 	if err != nil {
-		return 0, err
+		return
 	}
-	if marker != Amf3DoubleMarker {
-		return 0, &UnexpectedTypeError{marker}
+	n += m
+	for i, value := range values {
+		if className == "" {
+			m, err = e.amf3WriteUTF8(names[i])
+			if err != nil {
+				return
+			}
+			n += m
+		}
+		m, err = e.amf3WriteValue(value)
+		if err != nil {
+			return
+		}
+		n += m
 	}
-	err = binary.Read(r, binary.BigEndian, &num)
-	return
-}
-
-func Amf3ReadObjectName(r Reader) (name string, err error) {
-	return Amf3ReadUTF8(r)
+	if className != "" {
+		return n, nil
+	}
+	m, err = Amf3WriteObjectEndMarker(e.w)
+	return n + m, err
 }
 
-func Amf3ReadObject(r Reader) (obj Object, err error) {
-	marker, err := ReadMarker(r)
-	if err != nil {
-		return nil, err
+// sortedProperties returns the properties of obj sorted by name.
+func sortedProperties(obj Object) OrderedObject {
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
 	}
-	if marker != Amf3ObjectMarker {
-		return nil, &UnexpectedTypeError{marker}
+	sort.Strings(names)
+	props := make(OrderedObject, len(names))
+	for i, name := range names {
+		props[i] = Property{name, obj[name]}
 	}
-	return Amf3ReadObjectProperty(r)
+	return props
 }
 
-func Amf3ReadObjectProperty(r Reader) (Object, error) {
-	obj := make(Object)
-	// Read traits flag
-	b, err := r.ReadByte()
+// amf3WriteArray writes an array-type with the elements of dense as the dense
+// part and the properties of assoc, in order, as the associative part.
+func (e *Encoder) amf3WriteArray(key refKey, canRef bool, dense reflect.Value, assoc OrderedObject) (n int, err error) {
+	n, err = WriteMarker(e.w, Amf3ArrayMarker)
 	if err != nil {
-		return nil, err
+		return
 	}
-	if b != 0x0b {
-		return nil, &UnsupportedTypeError{"traits object"}
+	m, ok, err := e.amf3WriteReferenceKey(key, canRef)
+	n += m
+	if ok || err != nil {
+		return
 	}
-	// Read empty string
-	b, err = r.ReadByte()
+	length := dense.Len()
+	m, err = Amf3WriteU29(e.w, uint32(length<<1|0x01))
 	if err != nil {
-		return nil, err
-	}
-	if b != 0x01 {
-		return nil, &UnsupportedTypeError{"traits object"}
+		return
 	}
-	for {
-		name, err := Amf3ReadObjectName(r)
+	n += m
+	for _, p := range assoc {
+		m, err = e.amf3WriteUTF8(p.Name)
 		if err != nil {
-			return nil, err
-		}
-		if name == "" {
-			break
+			return
 		}
-		if _, ok := obj[name]; ok {
-			return nil, &PropertyExistError{name}
+		n += m
+		m, err = e.amf3WriteValue(p.Value)
+		if err != nil {
+			return
+		}
+		n += m
+	}
+	err = e.w.WriteByte(0x01) // empty string
+	if err != nil {
+		return
+	}
+	n += 1
+	for i := 0; i < length; i++ {
+		m, err = e.amf3WriteValue(dense.Index(i).Interface())
+		if err != nil {
+			return
+		}
+		n += m
+	}
+	return n, nil
+}
+
+// amf3WriteVector writes a vector-type. items holds int32, uint32, float64 or
+// arbitrary values depending on marker.
+func (e *Encoder) amf3WriteVector(key refKey, canRef bool, marker byte, fixed bool, typeName string, items reflect.Value) (n int, err error) {
+	n, err = WriteMarker(e.w, marker)
+	if err != nil {
+		return
+	}
+	m, ok, err := e.amf3WriteReferenceKey(key, canRef)
+	n += m
+	if ok || err != nil {
+		return
+	}
+	length := items.Len()
+	m, err = Amf3WriteU29(e.w, uint32(length<<1|0x01))
+	if err != nil {
+		return
+	}
+	n += m
+	var b byte
+	if fixed {
+		b = 0x01
+	}
+	err = e.w.WriteByte(b)
+	if err != nil {
+		return
+	}
+	n += 1
+	if marker == Amf3VectorObjectMarker {
+		m, err = e.amf3WriteUTF8(typeName)
+		if err != nil {
+			return
+		}
+		n += m
+	}
+	for i := 0; i < length; i++ {
+		item := items.Index(i)
+		switch marker {
+		case Amf3VectorIntMarker, Amf3VectorUintMarker, Amf3VectorDoubleMarker:
+			err = binary.Write(e.w, binary.BigEndian, item.Interface())
+			m = int(item.Type().Size())
+		default:
+			m, err = e.amf3WriteValue(item.Interface())
+		}
+		if err != nil {
+			return
+		}
+		n += m
+	}
+	return n, nil
+}
+
+// mapEntries returns the entries of the map v. If the Encoder is
+// deterministic they are ordered by the type of their keys and then by value.
+func (e *Encoder) mapEntries(v reflect.Value) ([]DictionaryEntry, error) {
+	keys := v.MapKeys()
+	if e.deterministic {
+		for _, k := range keys {
+			if !isOrderedKey(k) {
+				return nil, &UnsupportedValueError{k, "dictionary key of type " + k.Type().String() + " can not be ordered"}
+			}
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return lessKey(keys[i], keys[j])
+		})
+	}
+	entries := make([]DictionaryEntry, len(keys))
+	for i, k := range keys {
+		entries[i] = DictionaryEntry{k.Interface(), v.MapIndex(k).Interface()}
+	}
+	return entries, nil
+}
+
+// keyValue returns the dynamic value of the map key k, which is invalid for a
+// nil interface.
+func keyValue(k reflect.Value) reflect.Value {
+	if k.Kind() == reflect.Interface {
+		return k.Elem()
+	}
+	return k
+}
+
+// isOrderedKey reports whether the map key k can be ordered by lessKey: nil,
+// booleans, numbers and strings.
+func isOrderedKey(k reflect.Value) bool {
+	switch keyValue(k).Kind() {
+	case reflect.Invalid, reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// lessKey reports whether the map key a orders before b. Keys are ordered by
+// the name of their type, nil first, and keys of the same type by value.
+func lessKey(a, b reflect.Value) bool {
+	a, b = keyValue(a), keyValue(b)
+	if !a.IsValid() || !b.IsValid() {
+		return !a.IsValid() && b.IsValid()
+	}
+	if a.Type() != b.Type() {
+		return a.Type().String() < b.Type().String()
+	}
+	switch a.Kind() {
+	case reflect.Bool:
+		return !a.Bool() && b.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() < b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() < b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() < b.Float()
+	}
+	return a.String() < b.String()
+}
+
+// amf3WriteDictionary writes entries in order as a dictionary-type.
+func (e *Encoder) amf3WriteDictionary(key refKey, canRef bool, weakKeys bool, entries []DictionaryEntry) (n int, err error) {
+	n, err = WriteMarker(e.w, Amf3DictionaryMarker)
+	if err != nil {
+		return
+	}
+	m, ok, err := e.amf3WriteReferenceKey(key, canRef)
+	n += m
+	if ok || err != nil {
+		return
+	}
+	m, err = Amf3WriteU29(e.w, uint32(len(entries)<<1|0x01))
+	if err != nil {
+		return
+	}
+	n += m
+	var b byte
+	if weakKeys {
+		b = 0x01
+	}
+	err = e.w.WriteByte(b)
+	if err != nil {
+		return
+	}
+	n += 1
+	for _, entry := range entries {
+		m, err = e.amf3WriteValue(entry.Key)
+		if err != nil {
+			return
+		}
+		n += m
+		m, err = e.amf3WriteValue(entry.Value)
+		if err != nil {
+			return
+		}
+		n += m
+	}
+	return n, nil
+}
+
+// amf3WriteReference writes a U29O-ref if v has already been written in this
+// message. Otherwise v is added to the object reference table and the caller
+// writes it inline.
+func (e *Encoder) amf3WriteReference(v reflect.Value) (n int, ok bool, err error) {
+	return e.amf3WriteReferenceKey(referenceKey(v))
+}
+
+func (e *Encoder) amf3WriteReferenceKey(key refKey, canRef bool) (n int, ok bool, err error) {
+	if canRef {
+		if index, ok := e.objects[key]; ok {
+			n, err = Amf3WriteU29(e.w, uint32(index<<1))
+			return n, true, err
+		}
+		e.objects[key] = e.objectCount
+	}
+	e.objectCount++
+	return 0, false, nil
+}
+
+// amf3WriteTraits writes U29O-traits, or U29O-traits-ref if the same traits
+// have already been written in this message.
+func (e *Encoder) amf3WriteTraits(t *amf3Traits) (n int, err error) {
+	key := t.key()
+	if index, ok := e.traits[key]; ok {
+		return Amf3WriteU29(e.w, uint32(index<<2|0x01))
+	}
+	e.traits[key] = len(e.traits)
+	u := uint32(len(t.members)<<4 | 0x03)
+	if t.externalizable {
+		u |= 0x04
+	}
+	if t.dynamic {
+		u |= 0x08
+	}
+	n, err = Amf3WriteU29(e.w, u)
+	if err != nil {
+		return
+	}
+	m, err := e.amf3WriteUTF8(t.className)
+	if err != nil {
+		return
+	}
+	n += m
+	for _, member := range t.members {
+		m, err = e.amf3WriteUTF8(member)
+		if err != nil {
+			return
+		}
+		n += m
+	}
+	return n, nil
+}
+
+func Amf3WriteValue(w Writer, value interface{}) (n int, err error) {
+	return NewEncoder(w, AMF3).Encode(value)
+}
+
+func (e *Encoder) amf3WriteValue(value interface{}) (n int, err error) {
+	w := e.w
+	if value == nil {
+		return Amf3WriteNull(w)
+	}
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		return Amf3WriteNull(w)
+	}
+	if m, ok := marshaler(v); ok {
+		value, err = m.MarshalAMF(AMF3)
+		if err != nil {
+			return 0, err
+		}
+		r, self := selfMarshaled(reflect.ValueOf(value), v)
+		if !self {
+			return e.amf3WriteValue(value)
+		}
+		v, value = r, r.Interface()
+	}
+	if ext := externalizableByType(v.Type()); ext != nil && ext.write != nil {
+		key, canRef := referenceKey(v)
+		return e.amf3WriteExternalizable(key, canRef, ext.className, func() (int, error) {
+			return ext.write(e, value)
+		})
+	}
+	switch vt := value.(type) {
+	case XML:
+		return e.amf3WriteXML(Amf3XMLMarker, string(vt))
+	case XMLDocument:
+		return e.amf3WriteXML(Amf3XMLDocMarker, string(vt))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return e.amf3WriteString(v.String())
+	case reflect.Bool:
+		return Amf3WriteBoolean(w, v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := v.Int()
+		if i < Amf3IntegerMin || i > Amf3IntegerMax {
+			return Amf3WriteDouble(w, float64(i))
+		}
+		return Amf3WriteInteger(w, int32(i))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u := v.Uint()
+		if u > Amf3IntegerMax {
+			return Amf3WriteDouble(w, float64(u))
+		}
+		return Amf3WriteInteger(w, int32(u))
+	case reflect.Float32, reflect.Float64:
+		return Amf3WriteDouble(w, v.Float())
+	case reflect.Array:
+		fallthrough
+	case reflect.Slice:
+		if obj, ok := value.(OrderedObject); ok {
+			return e.amf3WriteOrderedObject(obj)
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			// Byte array
+			n, err = WriteMarker(w, Amf3ByteArrayMarker)
+			if err != nil {
+				return
+			}
+			var m int
+			var ok bool
+			m, ok, err = e.amf3WriteReference(v)
+			n += m
+			if ok || err != nil {
+				return
+			}
+			b := v.Bytes()
+			length := len(b)
+			u := uint32((length << 1) | 0x01)
+			m, err = Amf3WriteU29(w, u)
+			if err != nil {
+				return
+			}
+			n += m
+			m, err = w.Write(b)
+			if err != nil {
+				return
+			}
+			n += m
+			return
+		}
+		key, canRef := referenceKey(v)
+		if e.arrayCollection {
+			wrapperKey := key
+			wrapperKey.t = reflect.TypeOf(ArrayCollection(nil))
+			return e.amf3WriteExternalizable(wrapperKey, canRef, ArrayCollectionClass, func() (int, error) {
+				return e.amf3WriteArray(key, canRef, v, nil)
+			})
+		}
+		return e.amf3WriteArray(key, canRef, v, nil)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			entries, err := e.mapEntries(v)
+			if err != nil {
+				return 0, err
+			}
+			key, canRef := referenceKey(v)
+			return e.amf3WriteDictionary(key, canRef, false, entries)
+		}
+		return e.amf3WriteMap(v, mapKeys(v))
+	case reflect.Ptr:
+		if v.IsNil() {
+			return Amf3WriteNull(w)
+		}
+		if t, ok := v.Elem().Interface().(time.Time); ok {
+			key, canRef := referenceKey(v)
+			return e.amf3WriteDate(key, canRef, t)
+		}
+		if date, ok := v.Elem().Interface().(Date); ok {
+			key, canRef := referenceKey(v)
+			return e.amf3WriteDate(key, canRef, date.Time)
+		}
+		if v.Elem().Kind() == reflect.Struct && !isValueType(v.Elem().Type()) {
+			return e.amf3WriteStruct(v)
+		}
+		return e.amf3WriteValue(v.Elem().Interface())
+	case reflect.Struct:
+		switch vt := value.(type) {
+		case Undefined:
+			return Amf3WriteUndefined(w)
+		case Number:
+			if i, ok := vt.Int64(); ok && vt.Integer && i >= Amf3IntegerMin && i <= Amf3IntegerMax {
+				return Amf3WriteInteger(w, int32(i))
+			}
+			return Amf3WriteDouble(w, vt.Value)
+		case TypedObject:
+			key, canRef := wrapperKey(v, vt.Object)
+			return e.amf3WriteTypedObject(key, canRef, vt)
+		case time.Time:
+			return e.amf3WriteDate(refKey{}, false, vt)
+		case Date:
+			return e.amf3WriteDate(refKey{}, false, vt.Time)
+		case EcmaArray:
+			key, canRef := wrapperKey(v, vt.Object)
+			return e.amf3WriteArray(key, canRef, reflect.ValueOf([]interface{}(nil)), sortedProperties(vt.Object))
+		case OrderedEcmaArray:
+			key, canRef := wrapperKey(v, vt.Properties)
+			return e.amf3WriteArray(key, canRef, reflect.ValueOf([]interface{}(nil)), vt.Properties)
+		case MixedArray:
+			key, canRef := wrapperKey(v, vt.Associative)
+			return e.amf3WriteArray(key, canRef, reflect.ValueOf(vt.Dense), sortedProperties(vt.Associative))
+		case VectorInt:
+			key, canRef := wrapperKey(v, vt.Items)
+			return e.amf3WriteVector(key, canRef, Amf3VectorIntMarker, vt.Fixed, "", reflect.ValueOf(vt.Items))
+		case VectorUint:
+			key, canRef := wrapperKey(v, vt.Items)
+			return e.amf3WriteVector(key, canRef, Amf3VectorUintMarker, vt.Fixed, "", reflect.ValueOf(vt.Items))
+		case VectorDouble:
+			key, canRef := wrapperKey(v, vt.Items)
+			return e.amf3WriteVector(key, canRef, Amf3VectorDoubleMarker, vt.Fixed, "", reflect.ValueOf(vt.Items))
+		case VectorObject:
+			key, canRef := wrapperKey(v, vt.Items)
+			return e.amf3WriteVector(key, canRef, Amf3VectorObjectMarker, vt.Fixed, vt.TypeName, reflect.ValueOf(vt.Items))
+		case Dictionary:
+			key, canRef := wrapperKey(v, vt.Entries)
+			return e.amf3WriteDictionary(key, canRef, vt.WeakKeys, vt.Entries)
+		}
+		return e.amf3WriteStruct(v)
+	}
+	if vt, ok := value.(Object); ok {
+		return e.amf3WriteObject(vt)
+	} else if vt, ok := value.([]interface{}); ok {
+		return 0, &UnsupportedTypeError{fmt.Sprintf("%+v", vt)}
+	}
+	return 0, &UnsupportedTypeError{v.Kind().String()}
+}
+
+// AMF3 read functions
+
+func Amf3ReadU29(r Reader) (n uint32, err error) {
+	var b byte
+	for i := 0; i < 3; i++ {
+		b, err = r.ReadByte()
+		if err != nil {
+			return
+		}
+		n = (n << 7) + uint32(b&0x7f)
+		if (b & 0x80) == 0 {
+			return
+		}
+	}
+	b, err = r.ReadByte()
+	if err != nil {
+		return
+	}
+	return (n << 8) + uint32(b), nil
+}
+
+func Amf3ReadUTF8(r Reader) (string, error) {
+	return NewDecoder(r, AMF3).amf3ReadUTF8()
+}
+
+// amf3ReadUTF8 reads UTF-8-vr, resolving U29S-ref against the string
+// reference table.
+func (d *Decoder) amf3ReadUTF8() (string, error) {
+	u, err := Amf3ReadU29(d.r)
+	if err != nil {
+		return "", err
+	}
+	if u&0x01 == 0 {
+		index := u >> 1
+		if index >= uint32(len(d.strings)) {
+			return "", &ReferenceError{"string", index}
+		}
+		return d.strings[index], nil
+	}
+	length := u >> 1
+	if length == 0 {
+		return "", nil
+	}
+	data, err := readBytes(d.r, length)
+	if err != nil {
+		return "", err
+	}
+	str := string(data)
+	d.strings = append(d.strings, str)
+	return str, nil
+}
+
+func Amf3ReadString(r Reader) (str string, err error) {
+	marker, err := ReadMarker(r)
+	if err != nil {
+		return "", err
+	}
+	if marker != Amf3StringMarker {
+		return "", &UnexpectedTypeError{marker}
+	}
+	return Amf3ReadUTF8(r)
+}
+
+func Amf3ReadInteger(r Reader) (num int32, err error) {
+	marker, err := ReadMarker(r)
+	if err != nil {
+		return 0, err
+	}
+	if marker != Amf3IntegerMarker {
+		return 0, &UnexpectedTypeError{marker}
+	}
+	return Amf3ReadS29(r)
+}
+
+// Amf3ReadS29 reads a U29 and sign-extends it from 29 bits.
+func Amf3ReadS29(r Reader) (int32, error) {
+	u, err := Amf3ReadU29(r)
+	if err != nil {
+		return 0, err
+	}
+	return int32(u<<3) >> 3, nil
+}
+
+func Amf3ReadDouble(r Reader) (num float64, err error) {
+	marker, err := ReadMarker(r)
+	if err != nil {
+		return 0, err
+	}
+	if marker != Amf3DoubleMarker {
+		return 0, &UnexpectedTypeError{marker}
+	}
+	err = binary.Read(r, binary.BigEndian, &num)
+	return
+}
+
+func Amf3ReadObjectName(r Reader) (name string, err error) {
+	return Amf3ReadUTF8(r)
+}
+
+func Amf3ReadObject(r Reader) (obj Object, err error) {
+	marker, err := ReadMarker(r)
+	if err != nil {
+		return nil, err
+	}
+	if marker != Amf3ObjectMarker {
+		return nil, &UnexpectedTypeError{marker}
+	}
+	return Amf3ReadObjectProperty(r)
+}
+
+// Amf3ReadObjectProperty reads an object after the object marker and returns
+// its properties. Objects that are not decoded as an Object or TypedObject,
+// such as externalizable objects, give an UnexpectedTypeError.
+func Amf3ReadObjectProperty(r Reader) (Object, error) {
+	value, err := NewDecoder(r, AMF3).amf3ReadObjectProperty()
+	if err != nil {
+		return nil, err
+	}
+	switch vt := value.(type) {
+	case Object:
+		return vt, nil
+	case TypedObject:
+		return vt.Object, nil
+	}
+	return nil, &UnexpectedTypeError{Amf3ObjectMarker}
+}
+
+// amf3ReadObjectProperty reads an object-type after the object marker.
+// Objects of a named class are returned as TypedObject, anonymous ones as Object.
+func (d *Decoder) amf3ReadObjectProperty() (interface{}, error) {
+	u, err := Amf3ReadU29(d.r)
+	if err != nil {
+		return nil, err
+	}
+	if u&0x01 == 0 {
+		return d.amf3ObjectReference(u >> 1)
+	}
+	traits, err := d.amf3ReadTraits(u)
+	if err != nil {
+		return nil, err
+	}
+	if traits.externalizable {
+		ext := externalizableByClass(traits.className)
+		if ext == nil || ext.read == nil {
+			return nil, &UnsupportedTypeError{"AMF3 externalizable object " + traits.className}
 		}
-		value, err := Amf3ReadValue(r)
+		index := len(d.objects)
+		d.objects = append(d.objects, nil)
+		value, err := ext.read(d)
+		if err != nil {
+			return nil, err
+		}
+		d.objects[index] = value
+		return value, nil
+	}
+
+	if traits.className == "" && d.orderedObjects {
+		return d.amf3ReadOrderedObject(traits)
+	}
+
+	obj := make(Object)
+	var result interface{} = obj
+	if traits.className != "" {
+		result = TypedObject{ClassName: traits.className, Object: obj, Sealed: traits.members, Dynamic: traits.dynamic}
+	}
+	index := len(d.objects)
+	d.objects = append(d.objects, result)
+	for _, name := range traits.members {
+		value, err := d.amf3ReadValue()
 		if err != nil {
 			return nil, err
 		}
 		obj[name] = value
 	}
+	if traits.dynamic {
+		err = d.amf3ReadDynamicMembers(obj)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if typed, ok := result.(TypedObject); ok {
+		result, err = typedValue(typed, AMF3)
+		if err != nil {
+			return nil, err
+		}
+		d.objects[index] = result
+	}
+	return result, nil
+}
+
+// amf3ReadOrderedObject reads the members of an anonymous object, in order.
+func (d *Decoder) amf3ReadOrderedObject(traits *amf3Traits) (OrderedObject, error) {
+	index := len(d.objects)
+	d.objects = append(d.objects, OrderedObject(nil))
+	var obj OrderedObject
+	names := make(map[string]struct{}, len(traits.members))
+	for _, name := range traits.members {
+		value, err := d.amf3ReadValue()
+		if err != nil {
+			return nil, err
+		}
+		names[name] = struct{}{}
+		obj = append(obj, Property{name, value})
+	}
+	if traits.dynamic {
+		for {
+			name, err := d.amf3ReadUTF8()
+			if err != nil {
+				return nil, err
+			}
+			if name == "" {
+				break
+			}
+			if _, ok := names[name]; ok {
+				return nil, &PropertyExistError{name}
+			}
+			names[name] = struct{}{}
+			value, err := d.amf3ReadValue()
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, Property{name, value})
+		}
+	}
+	d.objects[index] = obj
 	return obj, nil
 }
 
+// amf3ReadDynamicMembers reads the dynamic members of an object into obj, up
+// to the empty name that ends them.
+func (d *Decoder) amf3ReadDynamicMembers(obj Object) error {
+	for {
+		name, err := d.amf3ReadUTF8()
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			return nil
+		}
+		if _, ok := obj[name]; ok {
+			return &PropertyExistError{name}
+		}
+		value, err := d.amf3ReadValue()
+		if err != nil {
+			return err
+		}
+		obj[name] = value
+	}
+}
+
+// amf3ReadTraits reads the traits of an object whose U29O header u has
+// already been read, resolving U29O-traits-ref against the traits table.
+func (d *Decoder) amf3ReadTraits(u uint32) (*amf3Traits, error) {
+	if u&0x02 == 0 {
+		index := u >> 2
+		if index >= uint32(len(d.traits)) {
+			return nil, &ReferenceError{"traits", index}
+		}
+		return d.traits[index], nil
+	}
+	className, err := d.amf3ReadUTF8()
+	if err != nil {
+		return nil, err
+	}
+	traits := &amf3Traits{
+		className:      className,
+		externalizable: u&0x04 != 0,
+		dynamic:        u&0x08 != 0,
+	}
+	if !traits.externalizable {
+		count := u >> 4
+		traits.members = make([]string, 0, preallocLen(count))
+		for i := uint32(0); i < count; i++ {
+			name, err := d.amf3ReadUTF8()
+			if err != nil {
+				return nil, err
+			}
+			traits.members = append(traits.members, name)
+		}
+	}
+	d.traits = append(d.traits, traits)
+	return traits, nil
+}
+
+// amf3ObjectReference returns the entry at index of the object reference table.
+func (d *Decoder) amf3ObjectReference(index uint32) (interface{}, error) {
+	if index >= uint32(len(d.objects)) {
+		return nil, &ReferenceError{"object", index}
+	}
+	if _, ok := d.objects[index].(partialObject); ok {
+		return nil, &ReferenceError{"object", index}
+	}
+	return d.objects[index], nil
+}
+
+// partialObject stands in the object table for an array or vector longer
+// than maxPrealloc while its items are read. Its items are not allocated up
+// front, so a reference to it from within them cannot be resolved.
+type partialObject struct{}
+
+func Amf3ReadArray(r Reader) (interface{}, error) {
+	marker, err := ReadMarker(r)
+	if err != nil {
+		return nil, err
+	}
+	if marker != Amf3ArrayMarker {
+		return nil, &UnexpectedTypeError{marker}
+	}
+	return NewDecoder(r, AMF3).amf3ReadArray()
+}
+
+// amf3ReadArray reads an array-type after the array marker. A purely dense
+// array is returned as []interface{}, an array with an associative part as
+// MixedArray.
+func (d *Decoder) amf3ReadArray() (interface{}, error) {
+	u, err := Amf3ReadU29(d.r)
+	if err != nil {
+		return nil, err
+	}
+	if u&0x01 == 0 {
+		return d.amf3ObjectReference(u >> 1)
+	}
+	count := u >> 1
+	dense := make([]interface{}, preallocLen(count))
+	// The table entry is only known once the associative part has been
+	// read, so a reference to the array from within that part resolves to nil.
+	index := len(d.objects)
+	d.objects = append(d.objects, nil)
+	var assoc Object
+	for {
+		name, err := d.amf3ReadUTF8()
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			break
+		}
+		if assoc == nil {
+			assoc = make(Object)
+		}
+		if _, ok := assoc[name]; ok {
+			return nil, &PropertyExistError{name}
+		}
+		assoc[name], err = d.amf3ReadValue()
+		if err != nil {
+			return nil, err
+		}
+	}
+	var result interface{} = dense
+	if assoc != nil {
+		result = MixedArray{dense, assoc}
+	}
+	if count > maxPrealloc {
+		d.objects[index] = partialObject{}
+	} else {
+		d.objects[index] = result
+	}
+	for i := uint32(0); i < count; i++ {
+		value, err := d.amf3ReadValue()
+		if err != nil {
+			return nil, err
+		}
+		if int(i) < len(dense) {
+			dense[i] = value
+		} else {
+			dense = append(dense, value)
+		}
+	}
+	if count > maxPrealloc {
+		result = dense
+		if assoc != nil {
+			result = MixedArray{dense, assoc}
+		}
+		d.objects[index] = result
+	}
+	return result, nil
+}
+
+func Amf3ReadDate(r Reader) (time.Time, error) {
+	marker, err := ReadMarker(r)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if marker != Amf3DateMarker {
+		return time.Time{}, &UnexpectedTypeError{marker}
+	}
+	return NewDecoder(r, AMF3).amf3ReadDate()
+}
+
+// amf3ReadDate reads a date-type after the date marker.
+func (d *Decoder) amf3ReadDate() (time.Time, error) {
+	u, err := Amf3ReadU29(d.r)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if u&0x01 == 0 {
+		value, err := d.amf3ObjectReference(u >> 1)
+		if err != nil {
+			return time.Time{}, err
+		}
+		t, ok := value.(time.Time)
+		if !ok {
+			return time.Time{}, &ReferenceError{"date", u >> 1}
+		}
+		return t, nil
+	}
+	var ms float64
+	err = binary.Read(d.r, binary.BigEndian, &ms)
+	if err != nil {
+		return time.Time{}, &ReadDateError{fmt.Sprintf("read double %s", err)}
+	}
+	t := time.UnixMilli(int64(ms))
+	d.objects = append(d.objects, t)
+	return t, nil
+}
+
+// amf3ReadXML reads the payload of an xml-type or xml-doc-type after the marker.
+func (d *Decoder) amf3ReadXML(marker byte) (interface{}, error) {
+	u, err := Amf3ReadU29(d.r)
+	if err != nil {
+		return nil, err
+	}
+	if u&0x01 == 0 {
+		return d.amf3ObjectReference(u >> 1)
+	}
+	data, err := readBytes(d.r, u>>1)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{} = XML(data)
+	if marker == Amf3XMLDocMarker {
+		value = XMLDocument(data)
+	}
+	d.objects = append(d.objects, value)
+	return value, nil
+}
+
+// amf3ReadVector reads a vector-type after the marker.
+func (d *Decoder) amf3ReadVector(marker byte) (interface{}, error) {
+	u, err := Amf3ReadU29(d.r)
+	if err != nil {
+		return nil, err
+	}
+	if u&0x01 == 0 {
+		return d.amf3ObjectReference(u >> 1)
+	}
+	length := u >> 1
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	fixed := b != 0
+	switch marker {
+	case Amf3VectorIntMarker:
+		items, err := d.amf3ReadNumbers(reflect.TypeOf([]int32(nil)), length)
+		if err != nil {
+			return nil, err
+		}
+		vector := VectorInt{fixed, items.Interface().([]int32)}
+		d.objects = append(d.objects, vector)
+		return vector, nil
+	case Amf3VectorUintMarker:
+		items, err := d.amf3ReadNumbers(reflect.TypeOf([]uint32(nil)), length)
+		if err != nil {
+			return nil, err
+		}
+		vector := VectorUint{fixed, items.Interface().([]uint32)}
+		d.objects = append(d.objects, vector)
+		return vector, nil
+	case Amf3VectorDoubleMarker:
+		items, err := d.amf3ReadNumbers(reflect.TypeOf([]float64(nil)), length)
+		if err != nil {
+			return nil, err
+		}
+		vector := VectorDouble{fixed, items.Interface().([]float64)}
+		d.objects = append(d.objects, vector)
+		return vector, nil
+	}
+	typeName, err := d.amf3ReadUTF8()
+	if err != nil {
+		return nil, err
+	}
+	vector := VectorObject{fixed, typeName, make([]interface{}, preallocLen(length))}
+	index := len(d.objects)
+	if length > maxPrealloc {
+		d.objects = append(d.objects, partialObject{})
+	} else {
+		d.objects = append(d.objects, vector)
+	}
+	for i := uint32(0); i < length; i++ {
+		value, err := d.amf3ReadValue()
+		if err != nil {
+			return nil, err
+		}
+		if int(i) < len(vector.Items) {
+			vector.Items[i] = value
+		} else {
+			vector.Items = append(vector.Items, value)
+		}
+	}
+	d.objects[index] = vector
+	return vector, nil
+}
+
+// amf3ReadNumbers reads length big-endian numbers into a new slice of type t.
+// They are read in chunks of at most maxPrealloc, so the slice only grows as
+// the data arrives.
+func (d *Decoder) amf3ReadNumbers(t reflect.Type, length uint32) (reflect.Value, error) {
+	items := reflect.MakeSlice(t, 0, preallocLen(length))
+	chunk := reflect.MakeSlice(t, preallocLen(length), preallocLen(length))
+	for remaining := length; remaining > 0; {
+		part := chunk.Slice(0, preallocLen(remaining))
+		err := binary.Read(d.r, binary.BigEndian, part.Interface())
+		if err != nil {
+			return items, err
+		}
+		items = reflect.AppendSlice(items, part)
+		remaining -= uint32(part.Len())
+	}
+	return items, nil
+}
+
+// amf3ReadDictionary reads a dictionary-type after the marker.
+func (d *Decoder) amf3ReadDictionary() (interface{}, error) {
+	u, err := Amf3ReadU29(d.r)
+	if err != nil {
+		return nil, err
+	}
+	if u&0x01 == 0 {
+		return d.amf3ObjectReference(u >> 1)
+	}
+	length := u >> 1
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	// The entries are only known once they have been read, so a reference
+	// to the dictionary from within them resolves to an empty one.
+	dict := Dictionary{b != 0, make([]DictionaryEntry, 0, preallocLen(length))}
+	index := len(d.objects)
+	d.objects = append(d.objects, dict)
+	for i := uint32(0); i < length; i++ {
+		key, err := d.amf3ReadValue()
+		if err != nil {
+			return nil, err
+		}
+		value, err := d.amf3ReadValue()
+		if err != nil {
+			return nil, err
+		}
+		dict.Entries = append(dict.Entries, DictionaryEntry{key, value})
+	}
+	d.objects[index] = dict
+	return dict, nil
+}
+
 func Amf3ReadByteArray(r Reader) ([]byte, error) {
 	marker, err := ReadMarker(r)
 	if err != nil {
@@ -443,30 +1476,49 @@ func Amf3ReadByteArray(r Reader) ([]byte, error) {
 }
 
 func Amf3readByteArray(r Reader) ([]byte, error) {
-	length, err := Amf3ReadU29(r)
+	return NewDecoder(r, AMF3).amf3ReadByteArray()
+}
+
+func (d *Decoder) amf3ReadByteArray() ([]byte, error) {
+	length, err := Amf3ReadU29(d.r)
 	if err != nil {
 		return nil, err
 	}
 	if length&uint32(0x01) != uint32(0x01) {
-		return nil, &UnsupportedTypeError{"AMF3 byte array reference"}
+		value, err := d.amf3ObjectReference(length >> 1)
+		if err != nil {
+			return nil, err
+		}
+		buf, ok := value.([]byte)
+		if !ok {
+			return nil, &ReferenceError{"byte array", length >> 1}
+		}
+		return buf, nil
 	}
 	length = length >> 1
-	buf := make([]byte, length)
-	n, err := r.Read(buf)
+	buf, err := readBytes(d.r, length)
 	if err != nil {
 		return nil, err
 	}
-	if n != int(length) {
-		return nil, &LengthError{fmt.Sprintf("expect %d, got %d", length, n)}
-	}
+	d.objects = append(d.objects, buf)
 	return buf, nil
 }
 
 func Amf3ReadValue(r Reader) (value interface{}, err error) {
-	marker, err := ReadMarker(r)
+	return NewDecoder(r, AMF3).Decode()
+}
+
+func (d *Decoder) amf3ReadValue() (value interface{}, err error) {
+	marker, err := ReadMarker(d.r)
 	if err != nil {
 		return 0, err
 	}
+	return d.amf3ReadMarkedValue(marker)
+}
+
+// amf3ReadMarkedValue reads a value whose marker has already been read.
+func (d *Decoder) amf3ReadMarkedValue(marker byte) (value interface{}, err error) {
+	r := d.r
 	switch marker {
 	case Amf3UndefinedMarker:
 		return Undefined{}, nil
@@ -477,19 +1529,37 @@ func Amf3ReadValue(r Reader) (value interface{}, err error) {
 	case Amf3TrueMarker:
 		return true, nil
 	case Amf3IntegerMarker:
-		return Amf3ReadU29(r)
+		num, err := Amf3ReadS29(r)
+		if err != nil {
+			return nil, err
+		}
+		if d.numberMode == NumberDefault {
+			return num, nil
+		}
+		return d.number(float64(num), true), nil
 	case Amf3DoubleMarker:
 		var num float64
 		err = binary.Read(r, binary.BigEndian, &num)
-		return num, err
+		if err != nil {
+			return nil, err
+		}
+		return d.number(num, false), nil
 	case Amf3StringMarker:
-		return Amf3ReadUTF8(r)
+		return d.amf3ReadUTF8()
+	case Amf3XMLDocMarker, Amf3XMLMarker:
+		return d.amf3ReadXML(marker)
+	case Amf3DateMarker:
+		return d.amf3ReadDate()
 	case Amf3ArrayMarker:
-		// Todo: read array
+		return d.amf3ReadArray()
 	case Amf3ObjectMarker:
-		return Amf3ReadObjectProperty(r)
+		return d.amf3ReadObjectProperty()
 	case Amf3ByteArrayMarker:
-		return Amf3readByteArray(r)
+		return d.amf3ReadByteArray()
+	case Amf3VectorIntMarker, Amf3VectorUintMarker, Amf3VectorDoubleMarker, Amf3VectorObjectMarker:
+		return d.amf3ReadVector(marker)
+	case Amf3DictionaryMarker:
+		return d.amf3ReadDictionary()
 	}
 	return nil, &UnsupportedTypeError{fmt.Sprintf("%x", marker)}
 }
@@ -5,7 +5,11 @@ package goamf
 
 import (
 	"bytes"
+	"io"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 type testU29Case struct {
@@ -337,7 +341,10 @@ func TestAMF3_DecodeDouble(t *testing.T) {
 var testAMF3_DecodeCases = []TestEncodeValueCase{
 	{"1.2", 1.2, []byte{0x05, 0x3f, 0xf3, 0x33, 0x33, 0x33, 0x33, 0x33, 0x33}},
 	{"float64(1.2)", float64(1.2), []byte{0x05, 0x3f, 0xf3, 0x33, 0x33, 0x33, 0x33, 0x33, 0x33}},
-	{"1", uint32(1), []byte{0x04, 0x01}},
+	{"1", int32(1), []byte{0x04, 0x01}},
+	{"-1", int32(-1), []byte{0x04, 0xFF, 0xFF, 0xFF, 0xFF}},
+	{"max", int32(0x0FFFFFFF), []byte{0x04, 0xBF, 0xFF, 0xFF, 0xFF}},
+	{"min", int32(-0x10000000), []byte{0x04, 0xC0, 0x80, 0x80, 0x00}},
 	{"foo", "foo", []byte{0x06, 0x07, 'f', 'o', 'o'}},
 	{"empty string", "", []byte{0x06, 0x01}},
 	{"false", false, []byte{0x02}},
@@ -408,3 +415,712 @@ func TestAMF3_DecodeByteArray(t *testing.T) {
 	}
 
 }
+
+func TestAMF3_EncodeStringReference(t *testing.T) {
+	buf := new(bytes.Buffer)
+	n, err := Amf3WriteValue(buf, map[string]string{"foo": "foo", "bar": ""})
+	if err != nil {
+		t.Fatalf("TestAMF3_EncodeStringReference error: %s", err)
+	}
+	expect := []byte{0x0A, 0x0B, 0x01,
+		0x07, 'b', 'a', 'r', 0x06, 0x01,
+		0x07, 'f', 'o', 'o', 0x06, 0x02, // "foo" by reference
+		0x01,
+	}
+	got := buf.Bytes()
+	if !bytes.Equal(expect, got) {
+		t.Errorf("TestAMF3_EncodeStringReference expect %x got %x", expect, got)
+	}
+	if n != len(expect) {
+		t.Errorf("TestAMF3_EncodeStringReference return n: %d\n", n)
+	}
+
+	// References are kept across values until Reset.
+	buf.Reset()
+	enc := NewEncoder(buf, AMF3)
+	for i := 0; i < 2; i++ {
+		_, err = enc.Encode("foo")
+		if err != nil {
+			t.Fatalf("TestAMF3_EncodeStringReference error: %s", err)
+		}
+	}
+	enc.Reset()
+	_, err = enc.Encode("foo")
+	if err != nil {
+		t.Fatalf("TestAMF3_EncodeStringReference error: %s", err)
+	}
+	expect = []byte{0x06, 0x07, 'f', 'o', 'o', 0x06, 0x00, 0x06, 0x07, 'f', 'o', 'o'}
+	got = buf.Bytes()
+	if !bytes.Equal(expect, got) {
+		t.Errorf("TestAMF3_EncodeStringReference expect %x got %x", expect, got)
+	}
+}
+
+func TestAMF3_DecodeStringReference(t *testing.T) {
+	buf := bytes.NewReader(
+		[]byte{0x0A, 0x0B, 0x01,
+			0x03, 'a', 0x06, 0x07, 'f', 'o', 'o',
+			0x03, 'b', 0x06, 0x02, // "foo" by reference
+			0x03, 'c', 0x06, 0x00, // "a" by reference
+			0x01,
+		})
+	dec := NewDecoder(buf, AMF3)
+	got, err := dec.Decode()
+	if err != nil {
+		t.Fatalf("TestAMF3_DecodeStringReference error: %s", err)
+	}
+	obj := got.(Object)
+	if obj["a"] != "foo" || obj["b"] != "foo" || obj["c"] != "a" {
+		t.Errorf("TestAMF3_DecodeStringReference got %v", obj)
+	}
+
+	_, err = Amf3ReadUTF8(bytes.NewReader([]byte{0x02}))
+	if _, ok := err.(*ReferenceError); !ok {
+		t.Errorf("TestAMF3_DecodeStringReference expect ReferenceError got %v", err)
+	}
+}
+
+func TestAMF3_EncodeObjectReference(t *testing.T) {
+	buf := new(bytes.Buffer)
+	sub := Object{"a": "b"}
+	n, err := Amf3WriteValue(buf, map[string]interface{}{"x": sub, "y": sub, "z": Object{}})
+	if err != nil {
+		t.Fatalf("TestAMF3_EncodeObjectReference error: %s", err)
+	}
+	expect := []byte{0x0A, 0x0B, 0x01,
+		0x03, 'x', 0x0A, 0x01, 0x03, 'a', 0x06, 0x03, 'b', 0x01, // traits by reference
+		0x03, 'y', 0x0A, 0x02, // object by reference
+		0x03, 'z', 0x0A, 0x01, 0x01,
+		0x01,
+	}
+	got := buf.Bytes()
+	if !bytes.Equal(expect, got) {
+		t.Errorf("TestAMF3_EncodeObjectReference expect %x got %x", expect, got)
+	}
+	if n != len(expect) {
+		t.Errorf("TestAMF3_EncodeObjectReference return n: %d\n", n)
+	}
+
+	value, err := Amf3ReadValue(bytes.NewReader(got))
+	if err != nil {
+		t.Fatalf("TestAMF3_EncodeObjectReference read error: %s", err)
+	}
+	obj := value.(Object)
+	x, y := obj["x"].(Object), obj["y"].(Object)
+	x["c"] = "d"
+	if y["a"] != "b" || y["c"] != "d" {
+		t.Errorf("TestAMF3_EncodeObjectReference expect shared object got %v", y)
+	}
+	if len(obj["z"].(Object)) != 0 {
+		t.Errorf("TestAMF3_EncodeObjectReference expect empty object got %v", obj["z"])
+	}
+}
+
+func TestAMF3_DecodeTraitsReference(t *testing.T) {
+	buf := bytes.NewReader([]byte{
+		0x0A, 0x13, 0x01, 0x03, 'a', 0x04, 0x01, // sealed member a, not dynamic
+		0x0A, 0x01, 0x04, 0x02, // traits by reference
+	})
+	dec := NewDecoder(buf, AMF3)
+	for i := 1; i <= 2; i++ {
+		value, err := dec.Decode()
+		if err != nil {
+			t.Fatalf("TestAMF3_DecodeTraitsReference error: %s", err)
+		}
+		if obj := value.(Object); len(obj) != 1 || obj["a"] != int32(i) {
+			t.Errorf("TestAMF3_DecodeTraitsReference got %v", obj)
+		}
+	}
+
+	_, err := Amf3ReadObjectProperty(bytes.NewReader([]byte{0x02}))
+	if _, ok := err.(*ReferenceError); !ok {
+		t.Errorf("TestAMF3_DecodeTraitsReference expect ReferenceError got %v", err)
+	}
+
+	// 2^25-1 members with no names fails on the missing data instead of
+	// allocating the whole member list.
+	_, err = Amf3ReadValue(bytes.NewReader([]byte{0x0A, 0xFF, 0xFF, 0xFF, 0xF3, 0x01}))
+	if err == nil {
+		t.Errorf("TestAMF3_DecodeTraitsReference expect error for truncated traits")
+	}
+}
+
+func TestAMF3_TypedObject(t *testing.T) {
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf, AMF3)
+	enc.SetDeterministic(true)
+	for i := 0; i < 2; i++ {
+		_, err := enc.Encode(TypedObject{ClassName: "a.B", Object: Object{"y": "z", "x": true}})
+		if err != nil {
+			t.Fatalf("TestAMF3_TypedObject error: %s", err)
+		}
+	}
+	expect := []byte{
+		0x0A, 0x23, 0x07, 'a', '.', 'B', 0x03, 'x', 0x03, 'y', 0x03, 0x06, 0x03, 'z',
+		0x0A, 0x01, 0x03, 0x06, 0x06, // traits and "z" by reference
+	}
+	got := buf.Bytes()
+	if !bytes.Equal(expect, got) {
+		t.Errorf("TestAMF3_TypedObject expect %x got %x", expect, got)
+	}
+
+	dec := NewDecoder(bytes.NewReader(got), AMF3)
+	for i := 0; i < 2; i++ {
+		value, err := dec.Decode()
+		if err != nil {
+			t.Fatalf("TestAMF3_TypedObject read error: %s", err)
+		}
+		obj, ok := value.(TypedObject)
+		if !ok || obj.ClassName != "a.B" || obj.Object["x"] != true || obj.Object["y"] != "z" {
+			t.Errorf("TestAMF3_TypedObject got %#v", value)
+		}
+	}
+}
+
+func TestAMF3_TraitsMemberNames(t *testing.T) {
+	values := []TypedObject{
+		{ClassName: "C", Object: Object{"a,b": int32(1)}},
+		{ClassName: "C", Object: Object{"a": int32(2), "b": int32(3)}},
+	}
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf, AMF3)
+	for _, v := range values {
+		_, err := enc.Encode(v)
+		if err != nil {
+			t.Fatalf("TestAMF3_TraitsMemberNames error: %s", err)
+		}
+	}
+	dec := NewDecoder(buf, AMF3)
+	for _, v := range values {
+		value, err := dec.Decode()
+		if err != nil {
+			t.Fatalf("TestAMF3_TraitsMemberNames read error: %s", err)
+		}
+		obj, ok := value.(TypedObject)
+		if !ok || !reflect.DeepEqual(obj.Object, v.Object) {
+			t.Errorf("TestAMF3_TraitsMemberNames expect %#v got %#v", v.Object, value)
+		}
+	}
+	if buf.Len() != 0 {
+		t.Errorf("TestAMF3_TraitsMemberNames %d bytes left unread", buf.Len())
+	}
+}
+
+func TestAMF3_DecodeSealedDynamic(t *testing.T) {
+	data := []byte{
+		0x0A, 0x1B, 0x07, 'a', '.', 'B', 0x03, 'x', // dynamic, one sealed member
+		0x04, 0x01,
+		0x03, 'y', 0x04, 0x02,
+		0x01,
+	}
+	value, err := Amf3ReadValue(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("TestAMF3_DecodeSealedDynamic error: %s", err)
+	}
+	obj := value.(TypedObject)
+	if obj.ClassName != "a.B" || len(obj.Object) != 2 || obj.Object["x"] != int32(1) || obj.Object["y"] != int32(2) {
+		t.Errorf("TestAMF3_DecodeSealedDynamic got %#v", obj)
+	}
+
+	buf := new(bytes.Buffer)
+	_, err = Amf3WriteValue(buf, obj)
+	if err != nil {
+		t.Fatalf("TestAMF3_DecodeSealedDynamic write error: %s", err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("TestAMF3_DecodeSealedDynamic expect %x got %x", data, buf.Bytes())
+	}
+}
+
+func TestAMF3_EncodeStruct(t *testing.T) {
+	type sub struct {
+		Data string `amf:"data"`
+	}
+	type s struct {
+		Name   string `amf:"name"`
+		Sub    *sub   `amf:"sub"`
+		Unused string `amf:"-"`
+		hidden string
+	}
+	buf := new(bytes.Buffer)
+	_, err := Amf3WriteValue(buf, &s{"foo", &sub{"bar"}, "unused", "hidden"})
+	if err != nil {
+		t.Fatalf("TestAMF3_EncodeStruct error: %s", err)
+	}
+	expect := []byte{0x0A, 0x0B, 0x01,
+		0x09, 'n', 'a', 'm', 'e', 0x06, 0x07, 'f', 'o', 'o',
+		0x07, 's', 'u', 'b', 0x0A, 0x01, 0x09, 'd', 'a', 't', 'a', 0x06, 0x07, 'b', 'a', 'r', 0x01,
+		0x01,
+	}
+	got := buf.Bytes()
+	if !bytes.Equal(expect, got) {
+		t.Errorf("TestAMF3_EncodeStruct expect %x got %x", expect, got)
+	}
+}
+
+func TestAMF3_DecodeArray(t *testing.T) {
+	buf := bytes.NewReader([]byte{0x09, 0x05, 0x01,
+		0x04, 0x01,
+		0x09, 0x00, // the same array by reference
+	})
+	value, err := Amf3ReadValue(buf)
+	if err != nil {
+		t.Fatalf("TestAMF3_DecodeArray error: %s", err)
+	}
+	arr, ok := value.([]interface{})
+	if !ok || len(arr) != 2 || arr[0] != int32(1) {
+		t.Fatalf("TestAMF3_DecodeArray got %#v", value)
+	}
+	if inner, ok := arr[1].([]interface{}); !ok || len(inner) != 2 {
+		t.Errorf("TestAMF3_DecodeArray expect reference to itself got %#v", arr[1])
+	}
+}
+
+func TestAMF3_DecodeArrayLength(t *testing.T) {
+	items := make([]interface{}, 2000)
+	for i := range items {
+		items[i] = int32(i)
+	}
+	buf := new(bytes.Buffer)
+	_, err := Amf3WriteValue(buf, items)
+	if err != nil {
+		t.Fatalf("TestAMF3_DecodeArrayLength error: %s", err)
+	}
+	value, err := Amf3ReadValue(buf)
+	if err != nil {
+		t.Fatalf("TestAMF3_DecodeArrayLength error: %s", err)
+	}
+	if !reflect.DeepEqual(value, items) {
+		t.Errorf("TestAMF3_DecodeArrayLength got %d items", len(value.([]interface{})))
+	}
+
+	// A length of 2^27-1 with no elements fails on the missing data
+	// instead of allocating the whole array.
+	_, err = Amf3ReadValue(bytes.NewReader([]byte{0x09, 0xBF, 0xFF, 0xFF, 0xFF, 0x01}))
+	if err == nil {
+		t.Errorf("TestAMF3_DecodeArrayLength expect error for truncated array")
+	}
+
+	// A reference to an array or vector of 2000 items from within its own
+	// items cannot be resolved before they are all read.
+	for _, data := range [][]byte{
+		{Amf3ArrayMarker, 0x9F, 0x21, 0x01, Amf3ArrayMarker, 0x00},
+		{Amf3VectorObjectMarker, 0x9F, 0x21, 0x00, 0x01, Amf3VectorObjectMarker, 0x00},
+	} {
+		_, err = Amf3ReadValue(bytes.NewReader(data))
+		if _, ok := err.(*ReferenceError); !ok {
+			t.Errorf("TestAMF3_DecodeArrayLength expect ReferenceError got %v", err)
+		}
+	}
+}
+
+func TestAMF3_MixedArray(t *testing.T) {
+	buf := new(bytes.Buffer)
+	mixed := MixedArray{[]interface{}{"a"}, Object{"b": "c"}}
+	_, err := Amf3WriteValue(buf, mixed)
+	if err != nil {
+		t.Fatalf("TestAMF3_MixedArray error: %s", err)
+	}
+	expect := []byte{0x09, 0x03,
+		0x03, 'b', 0x06, 0x03, 'c',
+		0x01,
+		0x06, 0x03, 'a',
+	}
+	got := buf.Bytes()
+	if !bytes.Equal(expect, got) {
+		t.Errorf("TestAMF3_MixedArray expect %x got %x", expect, got)
+	}
+
+	value, err := Amf3ReadArray(bytes.NewReader(got))
+	if err != nil {
+		t.Fatalf("TestAMF3_MixedArray read error: %s", err)
+	}
+	m, ok := value.(MixedArray)
+	if !ok || len(m.Dense) != 1 || m.Dense[0] != "a" || len(m.Associative) != 1 || m.Associative["b"] != "c" {
+		t.Errorf("TestAMF3_MixedArray got %#v", value)
+	}
+}
+
+func TestAMF3_Date(t *testing.T) {
+	date := time.UnixMilli(1234567890123)
+	buf := new(bytes.Buffer)
+	_, err := Amf3WriteValue(buf, []interface{}{date, &date, &date})
+	if err != nil {
+		t.Fatalf("TestAMF3_Date error: %s", err)
+	}
+	expect := []byte{0x09, 0x07, 0x01,
+		0x08, 0x01, 0x42, 0x71, 0xf7, 0x1f, 0xb0, 0x4c, 0xb0, 0x00,
+		0x08, 0x01, 0x42, 0x71, 0xf7, 0x1f, 0xb0, 0x4c, 0xb0, 0x00,
+		0x08, 0x04, // the same pointer by reference
+	}
+	got := buf.Bytes()
+	if !bytes.Equal(expect, got) {
+		t.Errorf("TestAMF3_Date expect %x got %x", expect, got)
+	}
+
+	value, err := Amf3ReadValue(bytes.NewReader(got))
+	if err != nil {
+		t.Fatalf("TestAMF3_Date read error: %s", err)
+	}
+	for i, v := range value.([]interface{}) {
+		if d, ok := v.(time.Time); !ok || !d.Equal(date) {
+			t.Errorf("TestAMF3_Date item[%d] expect %v got %v", i, date, v)
+		}
+	}
+}
+
+func TestAMF3_XML(t *testing.T) {
+	buf := new(bytes.Buffer)
+	_, err := Amf3WriteValue(buf, []interface{}{XML("<a>b</a>"), XMLDocument("<c/>")})
+	if err != nil {
+		t.Fatalf("TestAMF3_XML error: %s", err)
+	}
+	expect := []byte{0x09, 0x05, 0x01,
+		0x0B, 0x11, '<', 'a', '>', 'b', '<', '/', 'a', '>',
+		0x07, 0x09, '<', 'c', '/', '>',
+	}
+	got := buf.Bytes()
+	if !bytes.Equal(expect, got) {
+		t.Errorf("TestAMF3_XML expect %x got %x", expect, got)
+	}
+
+	value, err := Amf3ReadValue(bytes.NewReader([]byte{0x09, 0x05, 0x01,
+		0x0B, 0x11, '<', 'a', '>', 'b', '<', '/', 'a', '>',
+		0x0B, 0x02, // by reference
+	}))
+	if err != nil {
+		t.Fatalf("TestAMF3_XML read error: %s", err)
+	}
+	arr := value.([]interface{})
+	if arr[0] != XML("<a>b</a>") || arr[1] != XML("<a>b</a>") {
+		t.Errorf("TestAMF3_XML got %#v", arr)
+	}
+
+	var a struct {
+		B string `xml:",chardata"`
+	}
+	err = arr[0].(XML).Unmarshal(&a)
+	if err != nil || a.B != "b" {
+		t.Errorf("TestAMF3_XML Unmarshal got %+v, %v", a, err)
+	}
+}
+
+func TestAMF3_PayloadLength(t *testing.T) {
+	long := strings.Repeat("x", 3000)
+	for _, v := range []interface{}{long, XML(long), XMLDocument(long), []byte(long)} {
+		buf := new(bytes.Buffer)
+		_, err := Amf3WriteValue(buf, v)
+		if err != nil {
+			t.Fatalf("TestAMF3_PayloadLength error: %s", err)
+		}
+		value, err := Amf3ReadValue(buf)
+		if err != nil {
+			t.Fatalf("TestAMF3_PayloadLength read error: %s", err)
+		}
+		if !reflect.DeepEqual(v, value) {
+			t.Errorf("TestAMF3_PayloadLength expect %T of %d bytes", v, len(long))
+		}
+	}
+
+	// A length of 2^28-1 with no data fails on the missing data instead of
+	// allocating the whole payload.
+	for _, marker := range []byte{Amf3StringMarker, Amf3XMLMarker, Amf3XMLDocMarker, Amf3ByteArrayMarker} {
+		_, err := Amf3ReadValue(bytes.NewReader([]byte{marker, 0xFF, 0xFF, 0xFF, 0xFF, 'x'}))
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("TestAMF3_PayloadLength expect ErrUnexpectedEOF for truncated %#x got %v", marker, err)
+		}
+	}
+}
+
+func TestAMF3_Vector(t *testing.T) {
+	cases := []TestEncodeValueCase{
+		{"Vector.<int>", VectorInt{false, []int32{1, -1}},
+			[]byte{0x0D, 0x05, 0x00, 0x00, 0x00, 0x00, 0x01, 0xFF, 0xFF, 0xFF, 0xFF}},
+		{"Vector.<uint>", VectorUint{true, []uint32{2}},
+			[]byte{0x0E, 0x03, 0x01, 0x00, 0x00, 0x00, 0x02}},
+		{"Vector.<Number>", VectorDouble{false, []float64{1.2}},
+			[]byte{0x0F, 0x03, 0x00, 0x3f, 0xf3, 0x33, 0x33, 0x33, 0x33, 0x33, 0x33}},
+		{"Vector.<a.B>", VectorObject{false, "a.B", []interface{}{"a.B"}},
+			[]byte{0x10, 0x03, 0x00, 0x07, 'a', '.', 'B', 0x06, 0x00}},
+	}
+	for _, c := range cases {
+		buf := new(bytes.Buffer)
+		n, err := Amf3WriteValue(buf, c.v)
+		if err != nil {
+			t.Errorf("TestAMF3_Vector(%s) error: %s", c.name, err)
+			continue
+		}
+		got := buf.Bytes()
+		if !bytes.Equal(c.expect, got) || n != len(c.expect) {
+			t.Errorf("TestAMF3_Vector(%s) expect %x got %x, n: %d", c.name, c.expect, got, n)
+		}
+		value, err := Amf3ReadValue(bytes.NewReader(got))
+		if err != nil {
+			t.Errorf("TestAMF3_Vector(%s) read error: %s", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(c.v, value) {
+			t.Errorf("TestAMF3_Vector(%s) expect %#v got %#v", c.name, c.v, value)
+		}
+	}
+}
+
+func TestAMF3_VectorLength(t *testing.T) {
+	doubles := VectorDouble{false, make([]float64, 3000)}
+	objects := VectorObject{false, "", make([]interface{}, 2000)}
+	for i := range doubles.Items {
+		doubles.Items[i] = float64(i) / 2
+	}
+	for i := range objects.Items {
+		objects.Items[i] = true
+	}
+	for _, v := range []interface{}{doubles, objects} {
+		buf := new(bytes.Buffer)
+		_, err := Amf3WriteValue(buf, v)
+		if err != nil {
+			t.Fatalf("TestAMF3_VectorLength error: %s", err)
+		}
+		value, err := Amf3ReadValue(buf)
+		if err != nil {
+			t.Fatalf("TestAMF3_VectorLength read error: %s", err)
+		}
+		if !reflect.DeepEqual(v, value) {
+			t.Errorf("TestAMF3_VectorLength expect %T of the same items", v)
+		}
+	}
+
+	// A length of 2^27-1 with no items fails on the missing data instead of
+	// allocating the whole vector or dictionary.
+	for _, marker := range []byte{
+		Amf3VectorIntMarker, Amf3VectorUintMarker, Amf3VectorDoubleMarker,
+		Amf3VectorObjectMarker, Amf3DictionaryMarker,
+	} {
+		_, err := Amf3ReadValue(bytes.NewReader([]byte{marker, 0xBF, 0xFF, 0xFF, 0xFF, 0x00, 0x01}))
+		if err == nil {
+			t.Errorf("TestAMF3_VectorLength expect error for truncated %#x", marker)
+		}
+	}
+}
+
+func TestAMF3_Dictionary(t *testing.T) {
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf, AMF3)
+	enc.SetDeterministic(true)
+	_, err := enc.Encode(map[int]string{2: "b", 1: "a"})
+	if err != nil {
+		t.Fatalf("TestAMF3_Dictionary error: %s", err)
+	}
+	expect := []byte{0x11, 0x05, 0x00,
+		0x04, 0x01, 0x06, 0x03, 'a',
+		0x04, 0x02, 0x06, 0x03, 'b',
+	}
+	got := buf.Bytes()
+	if !bytes.Equal(expect, got) {
+		t.Errorf("TestAMF3_Dictionary expect %x got %x", expect, got)
+	}
+
+	// Keys are ordered by type name, nil first, then by value.
+	buf = new(bytes.Buffer)
+	enc = NewEncoder(buf, AMF3)
+	enc.SetDeterministic(true)
+	_, err = enc.Encode(map[interface{}]bool{"b": true, 2: true, "a": true, 1.5: true, nil: true})
+	if err != nil {
+		t.Fatalf("TestAMF3_Dictionary error: %s", err)
+	}
+	expect = []byte{0x11, 0x0B, 0x00,
+		0x01, 0x03,
+		0x05, 0x3f, 0xf8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x03,
+		0x04, 0x02, 0x03,
+		0x06, 0x03, 'a', 0x03,
+		0x06, 0x03, 'b', 0x03,
+	}
+	if !bytes.Equal(expect, buf.Bytes()) {
+		t.Errorf("TestAMF3_Dictionary expect %x got %x", expect, buf.Bytes())
+	}
+	_, err = enc.Encode(map[*int]bool{new(int): true})
+	if _, ok := err.(*UnsupportedValueError); !ok {
+		t.Errorf("TestAMF3_Dictionary expect UnsupportedValueError for pointer key got %v", err)
+	}
+
+	value, err := Amf3ReadValue(bytes.NewReader([]byte{0x11, 0x03, 0x01, 0x03, 0x06, 0x03, 'a'}))
+	if err != nil {
+		t.Fatalf("TestAMF3_Dictionary read error: %s", err)
+	}
+	expectDict := Dictionary{true, []DictionaryEntry{{true, "a"}}}
+	if !reflect.DeepEqual(expectDict, value) {
+		t.Errorf("TestAMF3_Dictionary expect %#v got %#v", expectDict, value)
+	}
+
+	data := []byte{0x11, 0x05, 0x00,
+		0x0A, 0x0B, 0x01, 0x01, 0x06, 0x03, 'a', // object key
+		0x09, 0x03, 0x01, 0x04, 0x01, 0x06, 0x03, 'b', // array key
+	}
+	value, err = Amf3ReadValue(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("TestAMF3_Dictionary read error: %s", err)
+	}
+	expectDict = Dictionary{false, []DictionaryEntry{
+		{Object{}, "a"},
+		{[]interface{}{int32(1)}, "b"},
+	}}
+	if !reflect.DeepEqual(expectDict, value) {
+		t.Errorf("TestAMF3_Dictionary expect %#v got %#v", expectDict, value)
+	}
+	buf.Reset()
+	_, err = Amf3WriteValue(buf, value)
+	if err != nil {
+		t.Fatalf("TestAMF3_Dictionary error: %s", err)
+	}
+	if !bytes.Equal(data, buf.Bytes()) {
+		t.Errorf("TestAMF3_Dictionary expect %x got %x", data, buf.Bytes())
+	}
+
+	var m map[interface{}]string
+	err = Unmarshal(data, AMF3, &m)
+	if _, ok := err.(*UnmarshalTypeError); !ok {
+		t.Errorf("TestAMF3_Dictionary expect UnmarshalTypeError for object key got %v", err)
+	}
+}
+
+var testAMF3_EncodeIntegerCases = []TestEncodeValueCase{
+	{"1", 1, []byte{0x04, 0x01}},
+	{"-1", int8(-1), []byte{0x04, 0xFF, 0xFF, 0xFF, 0xFF}},
+	{"uint16(0x4000)", uint16(0x4000), []byte{0x04, 0x81, 0x80, 0x00}},
+	{"max", int32(0x0FFFFFFF), []byte{0x04, 0xBF, 0xFF, 0xFF, 0xFF}},
+	{"min", int64(-0x10000000), []byte{0x04, 0xC0, 0x80, 0x80, 0x00}},
+	{"max+1", uint32(0x10000000), []byte{0x05, 0x41, 0xb0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+	{"min-1", -0x10000001, []byte{0x05, 0xc1, 0xb0, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00}},
+}
+
+func TestAMF3_EncodeInteger(t *testing.T) {
+	for _, c := range testAMF3_EncodeIntegerCases {
+		buf := new(bytes.Buffer)
+		n, err := Amf3WriteValue(buf, c.v)
+		if err != nil {
+			t.Errorf("AMF3_WriteValue(%s) error: %s", c.name, err)
+			continue
+		}
+		got := buf.Bytes()
+		if !bytes.Equal(c.expect, got) || n != len(c.expect) {
+			t.Errorf("AMF3_WriteValue(%s) expect %x got %x, n: %d", c.name, c.expect, got, n)
+		}
+	}
+	_, err := Amf3WriteInteger(new(bytes.Buffer), 0x10000000)
+	if _, ok := err.(*OutOfRangeError); !ok {
+		t.Errorf("AMF3_WriteInteger expect OutOfRangeError got %v", err)
+	}
+}
+
+func TestAMF3_OrderedObject(t *testing.T) {
+	obj := OrderedObject{{"b", true}, {"a", false}}
+	buf := new(bytes.Buffer)
+	_, err := Amf3WriteValue(buf, obj)
+	if err != nil {
+		t.Fatalf("TestAMF3_OrderedObject error: %s", err)
+	}
+	expect := []byte{0x0A, 0x0B, 0x01, 0x03, 'b', 0x03, 0x03, 'a', 0x02, 0x01}
+	got := buf.Bytes()
+	if !bytes.Equal(expect, got) {
+		t.Errorf("TestAMF3_OrderedObject expect %x got %x", expect, got)
+	}
+
+	d := NewDecoder(bytes.NewReader(got), AMF3)
+	d.SetOrderedObjects(true)
+	value, err := d.Decode()
+	if err != nil {
+		t.Fatalf("TestAMF3_OrderedObject read error: %s", err)
+	}
+	if !reflect.DeepEqual(value, obj) {
+		t.Errorf("TestAMF3_OrderedObject expect %#v got %#v", obj, value)
+	}
+
+	// A dynamic member with the name of a sealed one
+	d = NewDecoder(bytes.NewReader([]byte{0x0A, 0x1B, 0x01, 0x03, 'a', 0x03, 0x00, 0x03, 0x01}), AMF3)
+	d.SetOrderedObjects(true)
+	_, err = d.Decode()
+	if _, ok := err.(*PropertyExistError); !ok {
+		t.Errorf("TestAMF3_OrderedObject expect PropertyExistError got %v", err)
+	}
+}
+
+func TestAMF3_OrderedEcmaArray(t *testing.T) {
+	arr := OrderedEcmaArray{Properties: OrderedObject{{"b", true}, {"a", false}}}
+	buf := new(bytes.Buffer)
+	_, err := Amf3WriteValue(buf, arr)
+	if err != nil {
+		t.Fatalf("TestAMF3_OrderedEcmaArray error: %s", err)
+	}
+	expect := []byte{0x09, 0x01, 0x03, 'b', 0x03, 0x03, 'a', 0x02, 0x01}
+	got := buf.Bytes()
+	if !bytes.Equal(expect, got) {
+		t.Errorf("TestAMF3_OrderedEcmaArray expect %x got %x", expect, got)
+	}
+
+	value, err := Amf3ReadValue(bytes.NewReader(got))
+	if err != nil {
+		t.Fatalf("TestAMF3_OrderedEcmaArray read error: %s", err)
+	}
+	mixed := MixedArray{[]interface{}{}, arr.Properties.Object()}
+	if !reflect.DeepEqual(value, mixed) {
+		t.Errorf("TestAMF3_OrderedEcmaArray expect %#v got %#v", mixed, value)
+	}
+}
+
+func TestAMF3_WriteObjectSorted(t *testing.T) {
+	obj := Object{"b": true, "a": Object{"d": false, "c": true}}
+	expect := []byte{0x0A, 0x0B, 0x01,
+		0x03, 'a', 0x0A, 0x01, 0x03, 'c', 0x03, 0x03, 'd', 0x02, 0x01,
+		0x03, 'b', 0x03,
+		0x01,
+	}
+	for i := 0; i < 10; i++ {
+		buf := new(bytes.Buffer)
+		_, err := Amf3WriteValue(buf, obj)
+		if err != nil {
+			t.Fatalf("TestAMF3_WriteObjectSorted error: %s", err)
+		}
+		if !bytes.Equal(expect, buf.Bytes()) {
+			t.Fatalf("TestAMF3_WriteObjectSorted expect %x got %x", expect, buf.Bytes())
+		}
+
+		// Amf3WriteObject itself only sorts when deterministic.
+		buf.Reset()
+		enc := NewEncoder(buf, AMF3)
+		enc.SetDeterministic(true)
+		_, err = enc.amf3WriteObject(obj)
+		if err != nil {
+			t.Fatalf("TestAMF3_WriteObjectSorted error: %s", err)
+		}
+		if !bytes.Equal(expect, buf.Bytes()) {
+			t.Fatalf("TestAMF3_WriteObjectSorted expect %x got %x", expect, buf.Bytes())
+		}
+	}
+}
+
+func TestAMF3_EncodeValuePointer(t *testing.T) {
+	values := []interface{}{
+		TypedObject{ClassName: "a.B", Object: Object{"x": "y"}},
+		Number{Value: 2, Integer: true},
+		Undefined{},
+		EcmaArray{Count: 1, Object: Object{"x": 1}},
+		MixedArray{Dense: []interface{}{1}},
+		VectorInt{Items: []int32{1, 2}},
+		VectorObject{TypeName: "a.B", Items: []interface{}{"x"}},
+		Dictionary{Entries: []DictionaryEntry{{Key: "x", Value: 1}}},
+	}
+	for _, v := range values {
+		expect := new(bytes.Buffer)
+		if _, err := Amf3WriteValue(expect, v); err != nil {
+			t.Fatalf("Amf3WriteValue %T error: %s", v, err)
+		}
+		p := reflect.New(reflect.TypeOf(v))
+		p.Elem().Set(reflect.ValueOf(v))
+		buf := new(bytes.Buffer)
+		if _, err := Amf3WriteValue(buf, p.Interface()); err != nil {
+			t.Fatalf("Amf3WriteValue *%T error: %s", v, err)
+		}
+		if !bytes.Equal(buf.Bytes(), expect.Bytes()) {
+			t.Errorf("Amf3WriteValue *%T expect %x got %x", v, expect.Bytes(), buf.Bytes())
+		}
+	}
+}
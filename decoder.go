@@ -0,0 +1,147 @@
+// Copyright (c) 2022 Furzoom.com, All rights reserved.
+// Author: mn, mn@furzoom.com
+
+package goamf
+
+import (
+	"bytes"
+	"io"
+	"math"
+)
+
+// Decoder reads AMF values from r.
+//
+// A Decoder owns the AMF0 object table and the AMF3 reference tables
+// (strings, objects and traits),
+// so one instance should be used per RTMP message or remoting body and
+// Reset before the next one.
+type Decoder struct {
+	r       Reader
+	version uint
+
+	// AMF0 reference table
+	amf0Objects []interface{}
+
+	// AMF3 reference tables
+	strings []string
+	objects []interface{}
+	traits  []*amf3Traits
+
+	orderedObjects bool
+	numberMode     NumberMode
+	dateTimezone   bool
+}
+
+// NewDecoder returns a Decoder that reads values of version AMF0 or AMF3 from r.
+func NewDecoder(r Reader, version uint) *Decoder {
+	return &Decoder{r: r, version: version}
+}
+
+// Reset clears the reference tables, so the next value starts a new message.
+func (d *Decoder) Reset() {
+	d.amf0Objects = d.amf0Objects[:0]
+	d.strings = d.strings[:0]
+	d.objects = d.objects[:0]
+	d.traits = d.traits[:0]
+}
+
+// Version returns the AMF version the Decoder reads.
+func (d *Decoder) Version() uint {
+	return d.version
+}
+
+// SetOrderedObjects sets whether anonymous objects are decoded as
+// OrderedObject, and AMF0 ECMA arrays as OrderedEcmaArray, keeping the order
+// of the properties on the wire.
+func (d *Decoder) SetOrderedObjects(on bool) {
+	d.orderedObjects = on
+}
+
+// SetNumberMode sets how numbers are decoded, see NumberMode.
+func (d *Decoder) SetNumberMode(mode NumberMode) {
+	d.numberMode = mode
+}
+
+// SetDateTimezone sets whether AMF0 dates are decoded as Date, keeping the
+// time zone field of the wire format, instead of time.Time.
+func (d *Decoder) SetDateTimezone(on bool) {
+	d.dateTimezone = on
+}
+
+// maxPrealloc bounds the number of elements allocated up front for a
+// collection whose length is read from the input. Larger collections grow as
+// their elements are read, so a short message cannot claim a large allocation.
+const maxPrealloc = 1024
+
+// preallocLen returns the number of elements to allocate up front for a
+// collection of n elements.
+func preallocLen(n uint32) int {
+	if n > maxPrealloc {
+		return maxPrealloc
+	}
+	return int(n)
+}
+
+// readBytes reads n bytes from r. Past maxPrealloc the buffer grows as the
+// data arrives, like the elements of a collection.
+func readBytes(r Reader, n uint32) ([]byte, error) {
+	if n <= maxPrealloc {
+		data := make([]byte, n)
+		_, err := io.ReadFull(r, data)
+		if err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+	var buf bytes.Buffer
+	_, err := io.CopyN(&buf, r, int64(n))
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// number returns the decoded value of a number read from a double marker, or
+// from an AMF3 integer marker if integer is true.
+func (d *Decoder) number(f float64, integer bool) interface{} {
+	switch d.numberMode {
+	case NumberInt64:
+		if f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+			return int64(f)
+		}
+	case NumberType:
+		return Number{f, integer}
+	}
+	return f
+}
+
+// Decode reads the next value from the underlying reader.
+func (d *Decoder) Decode() (value interface{}, err error) {
+	switch d.version {
+	case AMF0:
+		return d.readValue()
+	case AMF3:
+		return d.amf3ReadValue()
+	}
+	return nil, &UnsupportedVersionError{d.version}
+}
+
+// DecodeAMF3 reads the next AMF3 value, sharing the reference tables of the
+// message being decoded. It is meant for ExternalReader implementations.
+func (d *Decoder) DecodeAMF3() (value interface{}, err error) {
+	return d.amf3ReadValue()
+}
+
+// Read reads from the underlying reader, for raw data in ExternalReader
+// implementations.
+func (d *Decoder) Read(p []byte) (n int, err error) {
+	return d.r.Read(p)
+}
+
+// ReadByte reads a byte from the underlying reader.
+func (d *Decoder) ReadByte() (c byte, err error) {
+	return d.r.ReadByte()
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2022 Furzoom.com, All rights reserved.
+// Author: mn, mn@furzoom.com
+
+package goamf
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestDecoder_Decode(t *testing.T) {
+	buf := bytes.NewReader([]byte{
+		0x02, 0x00, 0x03, 'f', 'o', 'o',
+		0x01, 0x01,
+	})
+	dec := NewDecoder(buf, AMF0)
+	got, err := dec.Decode()
+	if err != nil {
+		t.Fatalf("Decoder.Decode error: %s", err)
+	}
+	if got != "foo" {
+		t.Errorf("Decoder.Decode expect foo got %v", got)
+	}
+	dec.Reset()
+	got, err = dec.Decode()
+	if err != nil {
+		t.Fatalf("Decoder.Decode error: %s", err)
+	}
+	if got != true {
+		t.Errorf("Decoder.Decode expect true got %v", got)
+	}
+}
+
+func TestDecoder_UnsupportedVersion(t *testing.T) {
+	buf := bytes.NewReader([]byte{0x01})
+	_, err := NewDecoder(buf, 2).Decode()
+	if _, ok := err.(*UnsupportedVersionError); !ok {
+		t.Errorf("Decoder.Decode expect UnsupportedVersionError got %v", err)
+	}
+}
+
+func TestDecoderNumberMode(t *testing.T) {
+	// AMF3 [5, 1.5, 2.0]
+	data := []byte{0x09, 0x07, 0x01,
+		0x04, 0x05,
+		0x05, 0x3f, 0xf8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x05, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+	cases := []struct {
+		mode   NumberMode
+		expect []interface{}
+	}{
+		{NumberDefault, []interface{}{int32(5), 1.5, 2.0}},
+		{NumberFloat64, []interface{}{5.0, 1.5, 2.0}},
+		{NumberInt64, []interface{}{int64(5), 1.5, int64(2)}},
+		{NumberType, []interface{}{Number{5, true}, Number{1.5, false}, Number{2, false}}},
+	}
+	for _, c := range cases {
+		d := NewDecoder(bytes.NewReader(data), AMF3)
+		d.SetNumberMode(c.mode)
+		value, err := d.Decode()
+		if err != nil {
+			t.Fatalf("Decode(%d) error: %s", c.mode, err)
+		}
+		if !reflect.DeepEqual(value, c.expect) {
+			t.Errorf("Decode(%d) expect %#v got %#v", c.mode, c.expect, value)
+		}
+		if c.mode != NumberType {
+			continue
+		}
+		buf := new(bytes.Buffer)
+		_, err = Amf3WriteValue(buf, value)
+		if err != nil {
+			t.Fatalf("Amf3WriteValue error: %s", err)
+		}
+		if !bytes.Equal(buf.Bytes(), data) {
+			t.Errorf("Amf3WriteValue expect %x got %x", data, buf.Bytes())
+		}
+	}
+
+	d := NewDecoder(bytes.NewReader([]byte{0x00, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}), AMF0)
+	d.SetNumberMode(NumberInt64)
+	value, err := d.Decode()
+	if err != nil || value != int64(2) {
+		t.Errorf("Decode AMF0 expect int64(2) got %#v, %v", value, err)
+	}
+}
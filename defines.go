@@ -3,7 +3,11 @@
 
 package goamf
 
-import "reflect"
+import (
+	"encoding/xml"
+	"reflect"
+	"time"
+)
 
 const (
 	AMF0 = uint(0)
@@ -36,19 +40,29 @@ const (
 )
 
 const (
-	Amf3UndefinedMarker = 0x00
-	Amf3NullMarker      = 0x01
-	Amf3FalseMarker     = 0x02
-	Amf3TrueMarker      = 0x03
-	Amf3IntegerMarker   = 0x04
-	Amf3DoubleMarker    = 0x05
-	Amf3StringMarker    = 0x06
-	Amf3XMLDocMarker    = 0x07
-	Amf3DateMarker      = 0x08
-	Amf3ArrayMarker     = 0x09
-	Amf3ObjectMarker    = 0x0a
-	Amf3XMLMarker       = 0x0b
-	Amf3ByteArrayMarker = 0x0c
+	Amf3IntegerMin = -0x10000000
+	Amf3IntegerMax = 0x0FFFFFFF
+)
+
+const (
+	Amf3UndefinedMarker    = 0x00
+	Amf3NullMarker         = 0x01
+	Amf3FalseMarker        = 0x02
+	Amf3TrueMarker         = 0x03
+	Amf3IntegerMarker      = 0x04
+	Amf3DoubleMarker       = 0x05
+	Amf3StringMarker       = 0x06
+	Amf3XMLDocMarker       = 0x07
+	Amf3DateMarker         = 0x08
+	Amf3ArrayMarker        = 0x09
+	Amf3ObjectMarker       = 0x0a
+	Amf3XMLMarker          = 0x0b
+	Amf3ByteArrayMarker    = 0x0c
+	Amf3VectorIntMarker    = 0x0d
+	Amf3VectorUintMarker   = 0x0e
+	Amf3VectorDoubleMarker = 0x0f
+	Amf3VectorObjectMarker = 0x10
+	Amf3DictionaryMarker   = 0x11
 )
 
 type Writer interface {
@@ -64,9 +78,182 @@ type Reader interface {
 // Undefined type
 type Undefined struct{}
 
+// NumberMode selects the Go type of decoded numbers.
+type NumberMode int
+
+const (
+	// NumberDefault decodes AMF0 numbers and AMF3 doubles as float64, and AMF3
+	// integers as int32.
+	NumberDefault NumberMode = iota
+	// NumberFloat64 decodes all numbers as float64.
+	NumberFloat64
+	// NumberInt64 decodes integral numbers as int64, others as float64.
+	NumberInt64
+	// NumberType decodes all numbers as Number.
+	NumberType
+)
+
+// Number is a decoded number that remembers whether it was read from an AMF3
+// integer marker. AMF3 encoders write it back the same way.
+type Number struct {
+	Value   float64
+	Integer bool
+}
+
+// Int64 returns the number as an int64, and false if it is not integral.
+func (n Number) Int64() (int64, bool) {
+	i := int64(n.Value)
+	return i, float64(i) == n.Value
+}
+
 // Object type
 type Object map[string]interface{}
 
+// Property is a property of an OrderedObject.
+type Property struct {
+	Name  string
+	Value interface{}
+}
+
+// OrderedObject is an anonymous object whose properties are written in
+// order, for peers that depend on the order of the properties, such as the
+// command object of an RTMP connect.
+type OrderedObject []Property
+
+// Get returns the value of the property name.
+func (o OrderedObject) Get(name string) (value interface{}, ok bool) {
+	for _, p := range o {
+		if p.Name == name {
+			return p.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Set sets the value of the property name, appending it if it is not
+// present yet.
+func (o *OrderedObject) Set(name string, value interface{}) {
+	for i := range *o {
+		if (*o)[i].Name == name {
+			(*o)[i].Value = value
+			return
+		}
+	}
+	*o = append(*o, Property{name, value})
+}
+
+// Object returns the properties of o as an Object.
+func (o OrderedObject) Object() Object {
+	obj := make(Object, len(o))
+	for _, p := range o {
+		obj[p.Name] = p.Value
+	}
+	return obj
+}
+
+// EcmaArray is an AMF0 ECMA array, an associative array such as the
+// onMetaData of an RTMP stream. Count is the count sent before the
+// properties, which readers treat as a hint.
+type EcmaArray struct {
+	Count  uint32
+	Object Object
+}
+
+// OrderedEcmaArray is an EcmaArray whose properties keep their order.
+type OrderedEcmaArray struct {
+	Count      uint32
+	Properties OrderedObject
+}
+
+// TypedObject is an object with a class alias, such as the value objects
+// sent by Flex clients (e.g. "com.example.User").
+//
+// Sealed and Dynamic record the AMF3 traits of the class: the names of its
+// sealed members in order, and whether it also has dynamic members. The
+// decoder fills them so that an object is written back with the traits it
+// was read with. When both are zero, all properties are written as sealed
+// members; otherwise properties not listed in Sealed are written as dynamic
+// members, or dropped if Dynamic is false.
+type TypedObject struct {
+	ClassName string
+	Object    Object
+	Sealed    []string
+	Dynamic   bool
+}
+
+// Date is an AMF0 date with the time zone field of the wire format, which
+// Flash Player fills with its offset from UTC in minutes. time.Time values
+// are written with a zero time zone. Dates are decoded as Date only when
+// Decoder.SetDateTimezone is on, and as time.Time otherwise.
+type Date struct {
+	Time     time.Time
+	Timezone int16
+}
+
+// XML is an E4X XML value, sent as the AMF3 xml-type.
+type XML string
+
+// Unmarshal parses the XML payload into v through encoding/xml.
+func (x XML) Unmarshal(v interface{}) error {
+	return xml.Unmarshal([]byte(x), v)
+}
+
+// XMLDocument is a legacy flash.xml.XMLDocument value, sent as the AMF0
+// xml-document-type or the AMF3 xml-doc-type.
+type XMLDocument string
+
+// Unmarshal parses the XML payload into v through encoding/xml.
+func (x XMLDocument) Unmarshal(v interface{}) error {
+	return xml.Unmarshal([]byte(x), v)
+}
+
+// MixedArray is an AMF3 array with an associative part. The dense part
+// holds the elements at the ordinal indices 0..n-1.
+type MixedArray struct {
+	Dense       []interface{}
+	Associative Object
+}
+
+// VectorInt is an AMF3 Vector.<int>.
+type VectorInt struct {
+	Fixed bool
+	Items []int32
+}
+
+// VectorUint is an AMF3 Vector.<uint>.
+type VectorUint struct {
+	Fixed bool
+	Items []uint32
+}
+
+// VectorDouble is an AMF3 Vector.<Number>.
+type VectorDouble struct {
+	Fixed bool
+	Items []float64
+}
+
+// VectorObject is an AMF3 Vector.<T>, TypeName is the class alias of T,
+// or empty for Vector.<Object>.
+type VectorObject struct {
+	Fixed    bool
+	TypeName string
+	Items    []interface{}
+}
+
+// Dictionary is an AMF3 flash.utils.Dictionary. Its entries keep the order
+// they have on the wire, and keys may be of any type, including objects and
+// arrays.
+type Dictionary struct {
+	WeakKeys bool
+	Entries  []DictionaryEntry
+}
+
+// DictionaryEntry is a key and value pair of a Dictionary.
+type DictionaryEntry struct {
+	Key   interface{}
+	Value interface{}
+}
+
 // stringValues is a slice of reflect.Value holding *reflect.StringValue.
 // It implements the method to sort by string.
 type stringValues []reflect.Value
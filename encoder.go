@@ -0,0 +1,273 @@
+// Copyright (c) 2022 Furzoom.com, All rights reserved.
+// Author: mn, mn@furzoom.com
+
+package goamf
+
+import (
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Encoder writes AMF values to w.
+//
+// An Encoder owns the AMF0 object table and the AMF3 reference tables
+// (strings, objects and traits),
+// so one instance should be used per RTMP message or remoting body and
+// Reset before the next one.
+//
+// Struct fields are written in the order they are declared, and the entries
+// of Go maps written as values, Object included, in sorted key order.
+// SetDeterministic extends the sorted order to the remaining cases.
+type Encoder struct {
+	w       Writer
+	version uint
+
+	// AMF0 reference table
+	amf0Objects     map[refKey]int
+	amf0ObjectCount int
+
+	// AMF3 reference tables
+	strings     map[string]int
+	objects     map[refKey]int
+	objectCount int
+	traits      map[string]int
+
+	avmplus         bool
+	amf0References  bool
+	ecmaArray       bool
+	ecmaArraySlices bool
+	arrayCollection bool
+	deterministic   bool
+}
+
+// NewEncoder returns an Encoder that writes values of version AMF0 or AMF3 to w.
+func NewEncoder(w Writer, version uint) *Encoder {
+	e := &Encoder{w: w, version: version}
+	e.Reset()
+	return e
+}
+
+// Reset clears the reference tables, so the next value starts a new message.
+func (e *Encoder) Reset() {
+	e.amf0Objects = make(map[refKey]int)
+	e.amf0ObjectCount = 0
+	e.strings = make(map[string]int)
+	e.objects = make(map[refKey]int)
+	e.objectCount = 0
+	e.traits = make(map[string]int)
+}
+
+// Version returns the AMF version the Encoder writes.
+func (e *Encoder) Version() uint {
+	return e.version
+}
+
+// SetAvmplus sets whether an AMF0 Encoder writes values other than numbers,
+// booleans, strings, null and undefined as AMF3 after the avmplus-object
+// marker, as Flash Media Server answers objectEncoding 3 clients. The
+// switched values of one message share the AMF3 reference tables.
+func (e *Encoder) SetAvmplus(on bool) {
+	e.avmplus = on
+}
+
+// SetAmf0References sets whether a map, slice or struct pointer written again
+// in the same AMF0 message is sent as a reference-type.
+func (e *Encoder) SetAmf0References(on bool) {
+	e.amf0References = on
+}
+
+// SetEcmaArray sets whether Go maps with string keys, other than Object, are
+// written as AMF0 ECMA arrays instead of anonymous objects.
+func (e *Encoder) SetEcmaArray(on bool) {
+	e.ecmaArray = on
+}
+
+// SetEcmaArraySlices sets whether Go slices and arrays are written as AMF0
+// ECMA arrays with the indices as keys, as older versions did, instead of
+// strict arrays.
+func (e *Encoder) SetEcmaArraySlices(on bool) {
+	e.ecmaArraySlices = on
+}
+
+// SetArrayCollection sets whether Go slices, other than byte slices, are
+// wrapped in a flex.messaging.io.ArrayCollection when written as AMF3.
+func (e *Encoder) SetArrayCollection(on bool) {
+	e.arrayCollection = on
+}
+
+// SetDeterministic sets whether the values that are otherwise written in map
+// order are sorted too, so that the output only depends on the value written:
+// the properties of an Object passed to WriteObject or Amf3WriteObject, and
+// the members of a TypedObject without recorded traits. Go maps written as
+// AMF3 dictionaries are ordered by the type of their keys and then by value;
+// keys other than booleans, numbers and strings can not be ordered and give
+// an UnsupportedValueError.
+func (e *Encoder) SetDeterministic(on bool) {
+	e.deterministic = on
+}
+
+// mapKeys returns the keys of the map v, which must be strings, in sorted
+// order.
+func mapKeys(v reflect.Value) []reflect.Value {
+	keys := v.MapKeys()
+	sort.Sort(stringValues(keys))
+	return keys
+}
+
+// objectKeys returns the keys of the map v, which must be strings, in sorted
+// order if the Encoder is deterministic and in map order otherwise.
+func (e *Encoder) objectKeys(v reflect.Value) []reflect.Value {
+	if e.deterministic {
+		return mapKeys(v)
+	}
+	return v.MapKeys()
+}
+
+// sortNames sorts names if the Encoder is deterministic.
+func (e *Encoder) sortNames(names []string) {
+	if e.deterministic {
+		sort.Strings(names)
+	}
+}
+
+// Encode writes value to the underlying writer.
+func (e *Encoder) Encode(value interface{}) (n int, err error) {
+	switch e.version {
+	case AMF0:
+		v := reflect.ValueOf(value)
+		if e.avmplus && !isAmf0Primitive(v) {
+			return e.writeAvmplus(value)
+		}
+		return e.writeValue(v)
+	case AMF3:
+		return e.amf3WriteValue(value)
+	}
+	return 0, &UnsupportedVersionError{e.version}
+}
+
+// EncodeAMF3 writes value as AMF3, sharing the reference tables of the
+// message being encoded. It is meant for ExternalWriter implementations.
+func (e *Encoder) EncodeAMF3(value interface{}) (n int, err error) {
+	return e.amf3WriteValue(value)
+}
+
+// Write writes p to the underlying writer, for raw data in ExternalWriter
+// implementations.
+func (e *Encoder) Write(p []byte) (n int, err error) {
+	return e.w.Write(p)
+}
+
+// WriteByte writes c to the underlying writer.
+func (e *Encoder) WriteByte(c byte) error {
+	return e.w.WriteByte(c)
+}
+
+// Marshaler is implemented by types that encode themselves. MarshalAMF is
+// called with the AMF version being written and returns the value to write
+// in place of the receiver, such as an Object or a TypedObject. A result of
+// the receiver's own type, or a pointer to it, is written as if the type did
+// not implement Marshaler.
+type Marshaler interface {
+	MarshalAMF(version uint) (interface{}, error)
+}
+
+// marshaler returns the Marshaler of v, also through the address of v when
+// MarshalAMF has a pointer receiver. Nil pointers are not marshaled.
+func marshaler(v reflect.Value) (Marshaler, bool) {
+	if v.Kind() == reflect.Ptr && v.IsNil() || !v.CanInterface() {
+		return nil, false
+	}
+	if m, ok := v.Interface().(Marshaler); ok {
+		return m, true
+	}
+	if v.Kind() != reflect.Ptr && v.CanAddr() {
+		m, ok := v.Addr().Interface().(Marshaler)
+		return m, ok
+	}
+	return nil, false
+}
+
+// selfMarshaled reports whether r, the result of MarshalAMF on v, has the
+// type of v up to pointers, and returns r without those pointers. Such a
+// result is written as if its type had no MarshalAMF method, so that
+// MarshalAMF is called at most once per value and returning the receiver
+// does not recurse forever.
+func selfMarshaled(r, v reflect.Value) (reflect.Value, bool) {
+	if !r.IsValid() {
+		return r, false
+	}
+	t, vt := r.Type(), v.Type()
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	for vt.Kind() == reflect.Ptr {
+		vt = vt.Elem()
+	}
+	if t != vt {
+		return r, false
+	}
+	for r.Kind() == reflect.Ptr && !r.IsNil() {
+		r = r.Elem()
+	}
+	return r, true
+}
+
+// valueTypes are the struct types, of this package or time.Time, that are
+// written as an AMF value of their own rather than as an object of their
+// fields.
+var valueTypes = map[reflect.Type]bool{
+	reflect.TypeOf(Undefined{}):        true,
+	reflect.TypeOf(Number{}):           true,
+	reflect.TypeOf(TypedObject{}):      true,
+	reflect.TypeOf(time.Time{}):        true,
+	reflect.TypeOf(Date{}):             true,
+	reflect.TypeOf(EcmaArray{}):        true,
+	reflect.TypeOf(OrderedEcmaArray{}): true,
+	reflect.TypeOf(MixedArray{}):       true,
+	reflect.TypeOf(VectorInt{}):        true,
+	reflect.TypeOf(VectorUint{}):       true,
+	reflect.TypeOf(VectorDouble{}):     true,
+	reflect.TypeOf(VectorObject{}):     true,
+	reflect.TypeOf(Dictionary{}):       true,
+}
+
+// isValueType reports whether values of the struct type t are written as an
+// AMF value of their own, so a pointer to one is written as the value it
+// points to instead of as a struct.
+func isValueType(t reflect.Type) bool {
+	return valueTypes[t]
+}
+
+// refKey identifies a Go value that may be sent by reference.
+type refKey struct {
+	t   reflect.Type
+	p   uintptr
+	len int
+}
+
+// referenceKey returns the reference key of v. Only non-nil maps, pointers
+// and slices have an identity, other values are always written inline.
+func referenceKey(v reflect.Value) (key refKey, ok bool) {
+	switch v.Kind() {
+	case reflect.Map, reflect.Ptr:
+		if v.IsNil() {
+			return key, false
+		}
+		return refKey{t: v.Type(), p: v.Pointer()}, true
+	case reflect.Slice:
+		if v.IsNil() {
+			return key, false
+		}
+		return refKey{t: v.Type(), p: v.Pointer(), len: v.Len()}, true
+	}
+	return key, false
+}
+
+// wrapperKey returns the reference key of v, a value type such as
+// TypedObject or VectorInt, from the map or slice inner it wraps.
+func wrapperKey(v reflect.Value, inner interface{}) (key refKey, ok bool) {
+	key, ok = referenceKey(reflect.ValueOf(inner))
+	key.t = v.Type()
+	return key, ok
+}
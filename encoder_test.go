@@ -0,0 +1,78 @@
+// Copyright (c) 2022 Furzoom.com, All rights reserved.
+// Author: mn, mn@furzoom.com
+
+package goamf
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestEncoder_Encode(t *testing.T) {
+	buf := new(bytes.Buffer)
+	enc := NewEncoder(buf, AMF0)
+	n, err := enc.Encode("foo")
+	if err != nil {
+		t.Fatalf("Encoder.Encode error: %s", err)
+	}
+	if n != 6 {
+		t.Errorf("Encoder.Encode return n: %d\n", n)
+	}
+	expect := []byte{0x02, 0x00, 0x03, 'f', 'o', 'o'}
+	if got := buf.Bytes(); !bytes.Equal(expect, got) {
+		t.Errorf("Encoder.Encode expect %x got %x", expect, got)
+	}
+
+	buf.Reset()
+	enc = NewEncoder(buf, AMF3)
+	_, err = enc.Encode("foo")
+	if err != nil {
+		t.Fatalf("Encoder.Encode error: %s", err)
+	}
+	expect = []byte{0x06, 0x07, 'f', 'o', 'o'}
+	if got := buf.Bytes(); !bytes.Equal(expect, got) {
+		t.Errorf("Encoder.Encode expect %x got %x", expect, got)
+	}
+}
+
+func TestEncoder_UnsupportedVersion(t *testing.T) {
+	buf := new(bytes.Buffer)
+	_, err := NewEncoder(buf, 2).Encode("foo")
+	if _, ok := err.(*UnsupportedVersionError); !ok {
+		t.Errorf("Encoder.Encode expect UnsupportedVersionError got %v", err)
+	}
+}
+
+func TestEncoderAvmplus(t *testing.T) {
+	buf := new(bytes.Buffer)
+	e := NewEncoder(buf, AMF0)
+	e.SetAvmplus(true)
+	for _, value := range []interface{}{"_result", 1, Object{"a": "x"}, Object{"b": "x"}} {
+		_, err := e.Encode(value)
+		if err != nil {
+			t.Fatalf("Encode error: %s", err)
+		}
+	}
+	expect := []byte{
+		0x02, 0x00, 0x07, '_', 'r', 'e', 's', 'u', 'l', 't',
+		0x00, 0x3f, 0xf0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x11, 0x0a, 0x0b, 0x01, 0x03, 'a', 0x06, 0x03, 'x', 0x01,
+		0x11, 0x0a, 0x01, 0x03, 'b', 0x06, 0x02, 0x01, // traits and "x" by reference
+	}
+	got := buf.Bytes()
+	if !bytes.Equal(expect, got) {
+		t.Fatalf("Encode expect %x got %x", expect, got)
+	}
+
+	d := NewDecoder(bytes.NewReader(got), AMF0)
+	for _, expect := range []interface{}{"_result", 1.0, Object{"a": "x"}, Object{"b": "x"}} {
+		value, err := d.Decode()
+		if err != nil {
+			t.Fatalf("Decode error: %s", err)
+		}
+		if !reflect.DeepEqual(value, expect) {
+			t.Errorf("Decode expect %#v got %#v", expect, value)
+		}
+	}
+}
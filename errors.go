@@ -89,3 +89,44 @@ type LengthError struct {
 func (e *LengthError) Error() string {
 	return "length error: " + e.name
 }
+
+type UnsupportedVersionError struct {
+	Version uint
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("unsupported AMF version: %d", e.Version)
+}
+
+type InvalidUnmarshalError struct {
+	Type reflect.Type
+}
+
+func (e *InvalidUnmarshalError) Error() string {
+	if e.Type == nil {
+		return "unmarshal into nil"
+	}
+	return "unmarshal into non-pointer or nil " + e.Type.String()
+}
+
+type UnmarshalTypeError struct {
+	Value string
+	Type  reflect.Type
+	Field string
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	if e.Field == "" {
+		return "cannot unmarshal " + e.Value + " into Go value of type " + e.Type.String()
+	}
+	return "cannot unmarshal " + e.Value + " into Go struct field " + e.Field + " of type " + e.Type.String()
+}
+
+type ReferenceError struct {
+	Type  string
+	Index uint32
+}
+
+func (e *ReferenceError) Error() string {
+	return fmt.Sprintf("invalid %s reference: %d", e.Type, e.Index)
+}
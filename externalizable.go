@@ -0,0 +1,59 @@
+// Copyright (c) 2022 Furzoom.com, All rights reserved.
+// Author: mn, mn@furzoom.com
+
+package goamf
+
+import (
+	"reflect"
+	"sync"
+)
+
+// ExternalReader reads the body of an externalizable object. d carries the
+// reference tables of the enclosing message, so nested values are read with
+// d.DecodeAMF3 and raw data with d.Read and d.ReadByte.
+type ExternalReader func(d *Decoder) (interface{}, error)
+
+// ExternalWriter writes the body of an externalizable object v, the
+// counterpart of ExternalReader.
+type ExternalWriter func(e *Encoder, v interface{}) (n int, err error)
+
+type externalizable struct {
+	className string
+	read      ExternalReader
+	write     ExternalWriter
+}
+
+var externalizables = struct {
+	sync.RWMutex
+	byClass map[string]*externalizable
+	byType  map[reflect.Type]*externalizable
+}{
+	byClass: make(map[string]*externalizable),
+	byType:  make(map[reflect.Type]*externalizable),
+}
+
+// RegisterExternalizable registers the codec of the AMF3 externalizable class
+// className (IExternalizable in ActionScript). read is used when an object of
+// that class is decoded. If v is not nil, values of the same Go type as v are
+// encoded as that class with write.
+func RegisterExternalizable(className string, v interface{}, read ExternalReader, write ExternalWriter) {
+	ext := &externalizable{className, read, write}
+	externalizables.Lock()
+	defer externalizables.Unlock()
+	externalizables.byClass[className] = ext
+	if v != nil {
+		externalizables.byType[reflect.TypeOf(v)] = ext
+	}
+}
+
+func externalizableByClass(className string) *externalizable {
+	externalizables.RLock()
+	defer externalizables.RUnlock()
+	return externalizables.byClass[className]
+}
+
+func externalizableByType(t reflect.Type) *externalizable {
+	externalizables.RLock()
+	defer externalizables.RUnlock()
+	return externalizables.byType[t]
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2022 Furzoom.com, All rights reserved.
+// Author: mn, mn@furzoom.com
+
+package goamf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+type testPoint struct {
+	X    int16
+	Name string
+}
+
+func init() {
+	RegisterExternalizable("test.Point", testPoint{},
+		func(d *Decoder) (interface{}, error) {
+			var p testPoint
+			err := binary.Read(d, binary.BigEndian, &p.X)
+			if err != nil {
+				return nil, err
+			}
+			name, err := d.DecodeAMF3()
+			if err != nil {
+				return nil, err
+			}
+			p.Name, _ = name.(string)
+			return p, nil
+		},
+		func(e *Encoder, v interface{}) (int, error) {
+			p := v.(testPoint)
+			err := binary.Write(e, binary.BigEndian, p.X)
+			if err != nil {
+				return 0, err
+			}
+			n, err := e.EncodeAMF3(p.Name)
+			return n + 2, err
+		})
+}
+
+func TestExternalizable(t *testing.T) {
+	buf := new(bytes.Buffer)
+	points := []interface{}{testPoint{1, "a"}, testPoint{2, "a"}}
+	n, err := Amf3WriteValue(buf, points)
+	if err != nil {
+		t.Fatalf("TestExternalizable error: %s", err)
+	}
+	expect := []byte{0x09, 0x05, 0x01,
+		0x0A, 0x07, 0x15, 't', 'e', 's', 't', '.', 'P', 'o', 'i', 'n', 't', 0x00, 0x01, 0x06, 0x03, 'a',
+		0x0A, 0x01, 0x00, 0x02, 0x06, 0x02, // traits and "a" by reference
+	}
+	got := buf.Bytes()
+	if !bytes.Equal(expect, got) || n != len(expect) {
+		t.Errorf("TestExternalizable expect %x got %x, n: %d", expect, got, n)
+	}
+
+	value, err := Amf3ReadValue(bytes.NewReader(got))
+	if err != nil {
+		t.Fatalf("TestExternalizable read error: %s", err)
+	}
+	if !reflect.DeepEqual(points, value) {
+		t.Errorf("TestExternalizable expect %v got %v", points, value)
+	}
+
+	_, err = Amf3ReadValue(bytes.NewReader([]byte{0x0A, 0x07, 0x03, 'x'}))
+	if _, ok := err.(*UnsupportedTypeError); !ok {
+		t.Errorf("TestExternalizable expect UnsupportedTypeError for unknown class got %v", err)
+	}
+}
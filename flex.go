@@ -0,0 +1,44 @@
+// Copyright (c) 2022 Furzoom.com, All rights reserved.
+// Author: mn, mn@furzoom.com
+
+package goamf
+
+// Class aliases of the Flex collection types, which are externalizable
+// wrappers around a single AMF3 value.
+const (
+	ArrayCollectionClass = "flex.messaging.io.ArrayCollection"
+	ArrayListClass       = "flex.messaging.io.ArrayList"
+	ObjectProxyClass     = "flex.messaging.io.ObjectProxy"
+)
+
+// ArrayCollection is written as a flex.messaging.io.ArrayCollection. On
+// decoding, the wrapper is dropped and only the array is returned.
+type ArrayCollection []interface{}
+
+// ArrayList is written as a flex.messaging.io.ArrayList. On decoding, the
+// wrapper is dropped and only the array is returned.
+type ArrayList []interface{}
+
+// ObjectProxy is written as a flex.messaging.io.ObjectProxy. On decoding,
+// the wrapper is dropped and only the object is returned.
+type ObjectProxy Object
+
+func init() {
+	RegisterExternalizable(ArrayCollectionClass, ArrayCollection(nil), readFlexWrapper,
+		func(e *Encoder, v interface{}) (int, error) {
+			return e.EncodeAMF3([]interface{}(v.(ArrayCollection)))
+		})
+	RegisterExternalizable(ArrayListClass, ArrayList(nil), readFlexWrapper,
+		func(e *Encoder, v interface{}) (int, error) {
+			return e.EncodeAMF3([]interface{}(v.(ArrayList)))
+		})
+	RegisterExternalizable(ObjectProxyClass, ObjectProxy(nil), readFlexWrapper,
+		func(e *Encoder, v interface{}) (int, error) {
+			return e.EncodeAMF3(Object(v.(ObjectProxy)))
+		})
+}
+
+// readFlexWrapper reads the body of a Flex collection, the wrapped value.
+func readFlexWrapper(d *Decoder) (interface{}, error) {
+	return d.DecodeAMF3()
+}
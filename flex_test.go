@@ -0,0 +1,72 @@
+// Copyright (c) 2022 Furzoom.com, All rights reserved.
+// Author: mn, mn@furzoom.com
+
+package goamf
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+var testArrayCollectionBytes = []byte{
+	0x0A, 0x07, 0x43, 'f', 'l', 'e', 'x', '.', 'm', 'e', 's', 's', 'a', 'g', 'i', 'n', 'g', '.', 'i', 'o', '.',
+	'A', 'r', 'r', 'a', 'y', 'C', 'o', 'l', 'l', 'e', 'c', 't', 'i', 'o', 'n',
+	0x09, 0x03, 0x01, 0x06, 0x03, 'a',
+}
+
+func TestFlex_DecodeArrayCollection(t *testing.T) {
+	value, err := Amf3ReadValue(bytes.NewReader(testArrayCollectionBytes))
+	if err != nil {
+		t.Fatalf("TestFlex_DecodeArrayCollection error: %s", err)
+	}
+	expect := []interface{}{"a"}
+	if !reflect.DeepEqual(expect, value) {
+		t.Errorf("TestFlex_DecodeArrayCollection expect %#v got %#v", expect, value)
+	}
+}
+
+func TestFlex_EncodeArrayCollection(t *testing.T) {
+	buf := new(bytes.Buffer)
+	_, err := Amf3WriteValue(buf, ArrayCollection{"a"})
+	if err != nil {
+		t.Fatalf("TestFlex_EncodeArrayCollection error: %s", err)
+	}
+	if got := buf.Bytes(); !bytes.Equal(testArrayCollectionBytes, got) {
+		t.Errorf("TestFlex_EncodeArrayCollection expect %x got %x", testArrayCollectionBytes, got)
+	}
+
+	buf.Reset()
+	enc := NewEncoder(buf, AMF3)
+	enc.SetArrayCollection(true)
+	_, err = enc.Encode([]string{"a"})
+	if err != nil {
+		t.Fatalf("TestFlex_EncodeArrayCollection error: %s", err)
+	}
+	if got := buf.Bytes(); !bytes.Equal(testArrayCollectionBytes, got) {
+		t.Errorf("TestFlex_EncodeArrayCollection expect %x got %x", testArrayCollectionBytes, got)
+	}
+}
+
+func TestFlex_ObjectProxy(t *testing.T) {
+	buf := new(bytes.Buffer)
+	_, err := Amf3WriteValue(buf, ObjectProxy{"a": "b"})
+	if err != nil {
+		t.Fatalf("TestFlex_ObjectProxy error: %s", err)
+	}
+	value, err := Amf3ReadValue(buf)
+	if err != nil {
+		t.Fatalf("TestFlex_ObjectProxy read error: %s", err)
+	}
+	expect := Object{"a": "b"}
+	if !reflect.DeepEqual(expect, value) {
+		t.Errorf("TestFlex_ObjectProxy expect %#v got %#v", expect, value)
+	}
+}
+
+func TestFlex_ReadObjectArrayCollection(t *testing.T) {
+	obj, err := Amf3ReadObject(bytes.NewReader(testArrayCollectionBytes))
+	if _, ok := err.(*UnexpectedTypeError); !ok {
+		t.Errorf("TestFlex_ReadObjectArrayCollection expect UnexpectedTypeError got %#v, %v", obj, err)
+	}
+}
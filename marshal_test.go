@@ -0,0 +1,118 @@
+// Copyright (c) 2022 Furzoom.com, All rights reserved.
+// Author: mn, mn@furzoom.com
+
+package goamf
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+type testCelsius float64
+
+func (c testCelsius) MarshalAMF(version uint) (interface{}, error) {
+	return fmt.Sprintf("%gC", float64(c)), nil
+}
+
+func (c *testCelsius) UnmarshalAMF(version uint, v interface{}) error {
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("testCelsius: unexpected %T", v)
+	}
+	var f float64
+	_, err := fmt.Sscanf(s, "%gC", &f)
+	*c = testCelsius(f)
+	return err
+}
+
+type testWeather struct {
+	City string
+	Temp testCelsius
+}
+
+func TestMarshaler(t *testing.T) {
+	buf := new(bytes.Buffer)
+	_, err := WriteValue(buf, testWeather{"a", 21.5})
+	if err != nil {
+		t.Fatalf("WriteValue error: %s", err)
+	}
+	expect := []byte{0x03,
+		0x00, 0x04, 'C', 'i', 't', 'y', 0x02, 0x00, 0x01, 'a',
+		0x00, 0x04, 'T', 'e', 'm', 'p', 0x02, 0x00, 0x05, '2', '1', '.', '5', 'C',
+		0x00, 0x00, 0x09,
+	}
+	if !bytes.Equal(buf.Bytes(), expect) {
+		t.Errorf("WriteValue expect %x got %x", expect, buf.Bytes())
+	}
+
+	buf.Reset()
+	_, err = Amf3WriteValue(buf, testCelsius(-3))
+	if err != nil {
+		t.Fatalf("Amf3WriteValue error: %s", err)
+	}
+	expect3 := []byte{0x06, 0x07, '-', '3', 'C'}
+	if !bytes.Equal(buf.Bytes(), expect3) {
+		t.Errorf("Amf3WriteValue expect %x got %x", expect3, buf.Bytes())
+	}
+}
+
+func TestUnmarshaler(t *testing.T) {
+	data := []byte{0x03,
+		0x00, 0x04, 'C', 'i', 't', 'y', 0x02, 0x00, 0x01, 'a',
+		0x00, 0x04, 'T', 'e', 'm', 'p', 0x02, 0x00, 0x05, '2', '1', '.', '5', 'C',
+		0x00, 0x00, 0x09,
+	}
+	var got testWeather
+	err := Unmarshal(data, AMF0, &got)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %s", err)
+	}
+	if got != (testWeather{"a", 21.5}) {
+		t.Errorf("Unmarshal got %+v", got)
+	}
+
+	var c *testCelsius
+	err = Unmarshal([]byte{0x06, 0x07, '-', '3', 'C'}, AMF3, &c)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %s", err)
+	}
+	if c == nil || *c != -3 {
+		t.Errorf("Unmarshal got %v", c)
+	}
+}
+
+type testVersioned struct {
+	A int
+}
+
+// MarshalAMF returns a value of its own type, which is written as is.
+func (v testVersioned) MarshalAMF(version uint) (interface{}, error) {
+	v.A++
+	return &v, nil
+}
+
+func TestMarshalerSelf(t *testing.T) {
+	buf := new(bytes.Buffer)
+	_, err := WriteValue(buf, testVersioned{1})
+	if err != nil {
+		t.Fatalf("WriteValue error: %s", err)
+	}
+	expect := []byte{0x03,
+		0x00, 0x01, 'A', 0x00, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x09,
+	}
+	if !bytes.Equal(buf.Bytes(), expect) {
+		t.Errorf("WriteValue expect %x got %x", expect, buf.Bytes())
+	}
+
+	buf.Reset()
+	_, err = Amf3WriteValue(buf, &testVersioned{1})
+	if err != nil {
+		t.Fatalf("Amf3WriteValue error: %s", err)
+	}
+	expect3 := []byte{0x0A, 0x0B, 0x01, 0x03, 'A', 0x04, 0x02, 0x01}
+	if !bytes.Equal(buf.Bytes(), expect3) {
+		t.Errorf("Amf3WriteValue expect %x got %x", expect3, buf.Bytes())
+	}
+}
@@ -0,0 +1,391 @@
+// Copyright (c) 2022 Furzoom.com, All rights reserved.
+// Author: mn, mn@furzoom.com
+
+package goamf
+
+import (
+	"encoding/binary"
+	"reflect"
+)
+
+// TokenKind is the kind of a Token.
+type TokenKind int
+
+const (
+	// TokenScalar is a value without children: a number, boolean, string,
+	// null, undefined, date, XML, byte array, or the value returned by the
+	// reader of an externalizable class.
+	TokenScalar TokenKind = iota
+	// TokenStartObject starts an object, an AMF0 ECMA array or an AMF3
+	// dictionary. Its properties follow as a TokenPropertyName and a value,
+	// the entries of a dictionary as a key and a value.
+	TokenStartObject
+	// TokenPropertyName is the name of the property whose value follows.
+	TokenPropertyName
+	// TokenStartArray starts a strict array, a vector, or the Flex collection
+	// of class Name, which holds a single value. An AMF3 array with an
+	// associative part gives its properties first, as for objects.
+	TokenStartArray
+	// TokenEnd ends the innermost object or array.
+	TokenEnd
+	// TokenReference is a reference to an object, array or typed object
+	// already started in this message.
+	TokenReference
+)
+
+// Token is an element of an AMF stream read by a Tokenizer.
+type Token struct {
+	Kind TokenKind
+	// Marker is the type marker of a scalar or of a started object or array,
+	// of version AMF0 or AMF3 depending on where it was read.
+	Marker byte
+	// Name is the property name of TokenPropertyName, and the class name of
+	// a typed object or the type name of an object vector.
+	Name string
+	// Value is the value of TokenScalar.
+	Value interface{}
+	// Len is the count of an ECMA array, and the number of elements of an
+	// array or vector or of entries of a dictionary.
+	Len int
+	// Index is the index of TokenReference in the object table.
+	Index int
+}
+
+type frameKind int
+
+const (
+	frameAmf0Object frameKind = iota
+	frameAmf0Array
+	frameAmf3Object
+	frameAmf3Array
+	frameAmf3Values
+	frameAmf3VectorInt
+	frameAmf3VectorUint
+	frameAmf3VectorDouble
+)
+
+// frame is an object or array being tokenized.
+type frame struct {
+	kind      frameKind
+	members   []string // sealed members of an AMF3 object
+	dynamic   bool     // the AMF3 object has dynamic members
+	names     bool     // the AMF3 array has an associative part left
+	remaining int      // elements left in an array
+	value     bool     // the value of a property name is next
+}
+
+// Tokenizer reads an AMF stream token by token, without building the
+// objects and arrays it contains. Its memory use grows with the nesting
+// depth and the AMF3 reference tables, not with the size of the values.
+type Tokenizer struct {
+	d     *Decoder
+	stack []frame
+}
+
+// NewTokenizer returns a Tokenizer that reads values of version AMF0 or AMF3
+// from r.
+func NewTokenizer(r Reader, version uint) *Tokenizer {
+	return &Tokenizer{d: NewDecoder(r, version)}
+}
+
+// Decoder returns the Decoder the Tokenizer reads with, to set its options
+// or to Reset it between messages.
+func (t *Tokenizer) Decoder() *Decoder {
+	return t.d
+}
+
+// Depth returns the number of objects and arrays started and not yet ended.
+func (t *Tokenizer) Depth() int {
+	return len(t.stack)
+}
+
+// Next returns the next token. At the end of the stream, between values, it
+// returns io.EOF.
+func (t *Tokenizer) Next() (Token, error) {
+	if len(t.stack) == 0 {
+		if t.d.version == AMF3 {
+			return t.amf3Value()
+		}
+		if t.d.version != AMF0 {
+			return Token{}, &UnsupportedVersionError{t.d.version}
+		}
+		return t.amf0Value()
+	}
+	f := &t.stack[len(t.stack)-1]
+	switch f.kind {
+	case frameAmf0Object:
+		if f.value {
+			f.value = false
+			return t.amf0Value()
+		}
+		name, err := ReadUTF8(t.d.r)
+		if err != nil {
+			return Token{}, err
+		}
+		if name == "" {
+			b, err := t.d.r.ReadByte()
+			if err != nil {
+				return Token{}, err
+			}
+			if b != Amf0ObjectEndMarker {
+				return Token{}, &ExpectedTypeError{b}
+			}
+			return t.end(), nil
+		}
+		f.value = true
+		return Token{Kind: TokenPropertyName, Name: name}, nil
+	case frameAmf0Array:
+		if f.remaining == 0 {
+			return t.end(), nil
+		}
+		f.remaining--
+		return t.amf0Value()
+	case frameAmf3Object:
+		if f.value {
+			f.value = false
+			return t.amf3Value()
+		}
+		if len(f.members) > 0 {
+			name := f.members[0]
+			f.members = f.members[1:]
+			f.value = true
+			return Token{Kind: TokenPropertyName, Name: name}, nil
+		}
+		if !f.dynamic {
+			return t.end(), nil
+		}
+		name, err := t.d.amf3ReadUTF8()
+		if err != nil {
+			return Token{}, err
+		}
+		if name == "" {
+			return t.end(), nil
+		}
+		f.value = true
+		return Token{Kind: TokenPropertyName, Name: name}, nil
+	case frameAmf3Array:
+		if f.value {
+			f.value = false
+			return t.amf3Value()
+		}
+		if f.names {
+			name, err := t.d.amf3ReadUTF8()
+			if err != nil {
+				return Token{}, err
+			}
+			if name != "" {
+				f.value = true
+				return Token{Kind: TokenPropertyName, Name: name}, nil
+			}
+			f.names = false
+		}
+		fallthrough
+	case frameAmf3Values:
+		if f.remaining == 0 {
+			return t.end(), nil
+		}
+		f.remaining--
+		return t.amf3Value()
+	case frameAmf3VectorInt, frameAmf3VectorUint, frameAmf3VectorDouble:
+		if f.remaining == 0 {
+			return t.end(), nil
+		}
+		f.remaining--
+		return t.amf3VectorItem(f.kind)
+	}
+	return Token{}, nil
+}
+
+// Skip reads the tokens up to the end of the innermost object or array,
+// such as the one started by the last token.
+func (t *Tokenizer) Skip() error {
+	depth := len(t.stack)
+	for len(t.stack) >= depth && depth > 0 {
+		_, err := t.Next()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Tokenizer) push(f frame) {
+	t.stack = append(t.stack, f)
+}
+
+func (t *Tokenizer) end() Token {
+	t.stack = t.stack[:len(t.stack)-1]
+	return Token{Kind: TokenEnd}
+}
+
+// amf0Value reads the next AMF0 value, returning its scalar or start token.
+func (t *Tokenizer) amf0Value() (Token, error) {
+	d := t.d
+	marker, err := ReadMarker(d.r)
+	if err != nil {
+		return Token{}, err
+	}
+	tok := Token{Kind: TokenStartObject, Marker: marker}
+	switch marker {
+	case Amf0ObjectMarker:
+	case Amf0TypedObjectMarker:
+		tok.Name, err = ReadUTF8(d.r)
+	case Amf0EcmaArrayMarker:
+		var count uint32
+		err = binary.Read(d.r, binary.BigEndian, &count)
+		tok.Len = int(count)
+	case Amf0StrictArrayMarker:
+		var count uint32
+		err = binary.Read(d.r, binary.BigEndian, &count)
+		if err != nil {
+			return Token{}, err
+		}
+		d.amf0Objects = append(d.amf0Objects, nil)
+		t.push(frame{kind: frameAmf0Array, remaining: int(count)})
+		return Token{Kind: TokenStartArray, Marker: marker, Len: int(count)}, nil
+	case Amf0ReferenceMarker:
+		var index uint16
+		err = binary.Read(d.r, binary.BigEndian, &index)
+		if err != nil {
+			return Token{}, err
+		}
+		if int(index) >= len(d.amf0Objects) {
+			return Token{}, &ReferenceError{"object", uint32(index)}
+		}
+		return Token{Kind: TokenReference, Marker: marker, Index: int(index)}, nil
+	case Amf0AvmplusObjectMarker:
+		return t.amf3Value()
+	default:
+		value, err := d.readMarkedValue(marker)
+		if err != nil {
+			return Token{}, err
+		}
+		return Token{Kind: TokenScalar, Marker: marker, Value: value}, nil
+	}
+	if err != nil {
+		return Token{}, err
+	}
+	d.amf0Objects = append(d.amf0Objects, nil)
+	t.push(frame{kind: frameAmf0Object})
+	return tok, nil
+}
+
+// amf3Value reads the next AMF3 value, returning its scalar or start token.
+func (t *Tokenizer) amf3Value() (Token, error) {
+	d := t.d
+	marker, err := ReadMarker(d.r)
+	if err != nil {
+		return Token{}, err
+	}
+	switch marker {
+	case Amf3ObjectMarker, Amf3ArrayMarker, Amf3DictionaryMarker,
+		Amf3VectorIntMarker, Amf3VectorUintMarker, Amf3VectorDoubleMarker, Amf3VectorObjectMarker:
+	default:
+		value, err := d.amf3ReadMarkedValue(marker)
+		if err != nil {
+			return Token{}, err
+		}
+		return Token{Kind: TokenScalar, Marker: marker, Value: value}, nil
+	}
+
+	u, err := Amf3ReadU29(d.r)
+	if err != nil {
+		return Token{}, err
+	}
+	if u&0x01 == 0 {
+		index := u >> 1
+		if index >= uint32(len(d.objects)) {
+			return Token{}, &ReferenceError{"object", index}
+		}
+		return Token{Kind: TokenReference, Marker: marker, Index: int(index)}, nil
+	}
+	if marker == Amf3ObjectMarker {
+		return t.amf3Object(u)
+	}
+
+	d.objects = append(d.objects, nil)
+	length := int(u >> 1)
+	if marker == Amf3ArrayMarker {
+		t.push(frame{kind: frameAmf3Array, names: true, remaining: length})
+		return Token{Kind: TokenStartArray, Marker: marker, Len: length}, nil
+	}
+	// The fixed flag of a vector or the weak keys flag of a dictionary
+	_, err = d.r.ReadByte()
+	if err != nil {
+		return Token{}, err
+	}
+	switch marker {
+	case Amf3DictionaryMarker:
+		t.push(frame{kind: frameAmf3Values, remaining: 2 * length})
+		return Token{Kind: TokenStartObject, Marker: marker, Len: length}, nil
+	case Amf3VectorIntMarker:
+		t.push(frame{kind: frameAmf3VectorInt, remaining: length})
+	case Amf3VectorUintMarker:
+		t.push(frame{kind: frameAmf3VectorUint, remaining: length})
+	case Amf3VectorDoubleMarker:
+		t.push(frame{kind: frameAmf3VectorDouble, remaining: length})
+	case Amf3VectorObjectMarker:
+		typeName, err := d.amf3ReadUTF8()
+		if err != nil {
+			return Token{}, err
+		}
+		t.push(frame{kind: frameAmf3Values, remaining: length})
+		return Token{Kind: TokenStartArray, Marker: marker, Name: typeName, Len: length}, nil
+	}
+	return Token{Kind: TokenStartArray, Marker: marker, Len: length}, nil
+}
+
+// amf3Object starts an AMF3 object whose U29O header u has been read.
+func (t *Tokenizer) amf3Object(u uint32) (Token, error) {
+	d := t.d
+	traits, err := d.amf3ReadTraits(u)
+	if err != nil {
+		return Token{}, err
+	}
+	tok := Token{Kind: TokenStartObject, Marker: Amf3ObjectMarker, Name: traits.className}
+	if !traits.externalizable {
+		d.objects = append(d.objects, nil)
+		t.push(frame{kind: frameAmf3Object, members: traits.members, dynamic: traits.dynamic})
+		return tok, nil
+	}
+	switch traits.className {
+	case ArrayCollectionClass, ArrayListClass, ObjectProxyClass:
+		// The body of a Flex collection is a single value, which is
+		// tokenized as the only element of the wrapper.
+		d.objects = append(d.objects, nil)
+		t.push(frame{kind: frameAmf3Values, remaining: 1})
+		tok.Kind = TokenStartArray
+		tok.Len = 1
+		return tok, nil
+	}
+	ext := externalizableByClass(traits.className)
+	if ext == nil || ext.read == nil {
+		return Token{}, &UnsupportedTypeError{"AMF3 externalizable object " + traits.className}
+	}
+	index := len(d.objects)
+	d.objects = append(d.objects, nil)
+	value, err := ext.read(d)
+	if err != nil {
+		return Token{}, err
+	}
+	d.objects[index] = value
+	return Token{Kind: TokenScalar, Marker: Amf3ObjectMarker, Name: traits.className, Value: value}, nil
+}
+
+// amf3VectorItem reads an item of a vector of int, uint or double.
+func (t *Tokenizer) amf3VectorItem(kind frameKind) (Token, error) {
+	var value interface{}
+	switch kind {
+	case frameAmf3VectorInt:
+		value = new(int32)
+	case frameAmf3VectorUint:
+		value = new(uint32)
+	default:
+		value = new(float64)
+	}
+	err := binary.Read(t.d.r, binary.BigEndian, value)
+	if err != nil {
+		return Token{}, err
+	}
+	return Token{Kind: TokenScalar, Value: reflect.ValueOf(value).Elem().Interface()}, nil
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2022 Furzoom.com, All rights reserved.
+// Author: mn, mn@furzoom.com
+
+package goamf
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func readTokens(t *testing.T, tz *Tokenizer) []Token {
+	var tokens []Token
+	for {
+		tok, err := tz.Next()
+		if err == io.EOF {
+			return tokens
+		}
+		if err != nil {
+			t.Fatalf("Next error: %s", err)
+		}
+		tokens = append(tokens, tok)
+	}
+}
+
+func TestTokenizer(t *testing.T) {
+	data := []byte{
+		0x02, 0x00, 0x0a, 'o', 'n', 'M', 'e', 't', 'a', 'D', 'a', 't', 'a',
+		0x08, 0x00, 0x00, 0x00, 0x02,
+		0x00, 0x08, 'd', 'u', 'r', 'a', 't', 'i', 'o', 'n', 0x00, 0x3f, 0xf0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x04, 't', 'a', 'g', 's', 0x0a, 0x00, 0x00, 0x00, 0x01, 0x02, 0x00, 0x01, 'a',
+		0x00, 0x00, 0x09,
+	}
+	got := readTokens(t, NewTokenizer(bytes.NewReader(data), AMF0))
+	expect := []Token{
+		{Kind: TokenScalar, Marker: Amf0StringMarker, Value: "onMetaData"},
+		{Kind: TokenStartObject, Marker: Amf0EcmaArrayMarker, Len: 2},
+		{Kind: TokenPropertyName, Name: "duration"},
+		{Kind: TokenScalar, Marker: Amf0NumberMarker, Value: 1.0},
+		{Kind: TokenPropertyName, Name: "tags"},
+		{Kind: TokenStartArray, Marker: Amf0StrictArrayMarker, Len: 1},
+		{Kind: TokenScalar, Marker: Amf0StringMarker, Value: "a"},
+		{Kind: TokenEnd},
+		{Kind: TokenEnd},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Tokenizer expect %+v got %+v", expect, got)
+	}
+}
+
+func TestTokenizer_AMF3(t *testing.T) {
+	buf := new(bytes.Buffer)
+	e := NewEncoder(buf, AMF3)
+	obj := Object{"a": []interface{}{1, "x"}, "v": VectorInt{Items: []int32{-1}}}
+	for _, value := range []interface{}{obj, obj, ArrayCollection{Object{"b": true}}, "end"} {
+		_, err := e.Encode(value)
+		if err != nil {
+			t.Fatalf("Encode error: %s", err)
+		}
+	}
+	tz := NewTokenizer(bytes.NewReader(buf.Bytes()), AMF3)
+	var got []Token
+	for {
+		tok, err := tz.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next error: %s", err)
+		}
+		got = append(got, tok)
+		if tok.Kind == TokenStartArray && tok.Name == ArrayCollectionClass {
+			err = tz.Skip()
+			if err != nil {
+				t.Fatalf("Skip error: %s", err)
+			}
+		}
+	}
+	expect := []Token{
+		{Kind: TokenStartObject, Marker: Amf3ObjectMarker},
+		{Kind: TokenPropertyName, Name: "a"},
+		{Kind: TokenStartArray, Marker: Amf3ArrayMarker, Len: 2},
+		{Kind: TokenScalar, Marker: Amf3IntegerMarker, Value: int32(1)},
+		{Kind: TokenScalar, Marker: Amf3StringMarker, Value: "x"},
+		{Kind: TokenEnd},
+		{Kind: TokenPropertyName, Name: "v"},
+		{Kind: TokenStartArray, Marker: Amf3VectorIntMarker, Len: 1},
+		{Kind: TokenScalar, Value: int32(-1)},
+		{Kind: TokenEnd},
+		{Kind: TokenEnd},
+		{Kind: TokenReference, Marker: Amf3ObjectMarker, Index: 0},
+		{Kind: TokenStartArray, Marker: Amf3ObjectMarker, Name: ArrayCollectionClass, Len: 1},
+		{Kind: TokenScalar, Marker: Amf3StringMarker, Value: "end"},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Tokenizer expect %+v got %+v", expect, got)
+	}
+}
@@ -0,0 +1,567 @@
+// Copyright (c) 2022 Furzoom.com, All rights reserved.
+// Author: mn, mn@furzoom.com
+
+package goamf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Unmarshal decodes the first value of version AMF0 or AMF3 in data and
+// stores the result in the value pointed to by v.
+//
+// Objects are stored into structs using the same `amf` tag rules as
+// WriteStruct, into maps with string keys, or into interface values.
+// Arrays are stored into slices and arrays. Values implementing Unmarshaler
+// decode themselves.
+func Unmarshal(data []byte, version uint, v interface{}) error {
+	return NewDecoder(bytes.NewReader(data), version).DecodeInto(v)
+}
+
+// DecodeInto reads the next value and stores it in the value pointed to by v.
+// See Unmarshal for the conversion rules.
+func (d *Decoder) DecodeInto(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return &InvalidUnmarshalError{reflect.TypeOf(v)}
+	}
+	value, err := d.Decode()
+	if err != nil {
+		return err
+	}
+	return unmarshalValue(value, rv.Elem(), "", d.version)
+}
+
+// Unmarshaler is implemented by types that decode themselves. UnmarshalAMF
+// is called with the AMF version and the decoded value, such as an Object,
+// before Unmarshal falls back to the conversion rules.
+type Unmarshaler interface {
+	UnmarshalAMF(version uint, v interface{}) error
+}
+
+// field is a struct field reachable from a struct type, including the
+// fields promoted from embedded and inline structs.
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	asString  bool
+}
+
+// parseTag splits an `amf` tag into its name and the comma separated options.
+func parseTag(tag string) (name string, options string) {
+	if i := strings.Index(tag, ","); i != -1 {
+		return tag[:i], tag[i+1:]
+	}
+	return tag, ""
+}
+
+// hasOption reports whether the comma separated options contain option.
+func hasOption(options string, option string) bool {
+	for options != "" {
+		var opt string
+		opt, options = parseTag(options)
+		if opt == option {
+			return true
+		}
+	}
+	return false
+}
+
+// structFields returns the fields of t that take part in encoding, in the
+// order WriteStruct writes them.
+//
+// The `amf` tag of a field gives its name, "-" to skip it, and the options:
+//
+//	omitempty  skip the field when it is a zero value or an empty slice or map
+//	inline     flatten the fields of a struct field into the parent
+//	string     write a number or boolean as a string, and parse it back
+//
+// A blank field tagged `amf:"com.example.User,class"` sets the class alias of
+// the struct, see structClass.
+func structFields(t reflect.Type) []field {
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Name == "_" {
+			continue
+		}
+		name, options := parseTag(sf.Tag.Get("amf"))
+		if name == "-" {
+			continue
+		}
+		if sf.Anonymous || hasOption(options, "inline") {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for _, f := range structFields(ft) {
+					f.index = append([]int{i}, f.index...)
+					fields = append(fields, f)
+				}
+				continue
+			}
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, field{
+			name:      name,
+			index:     []int{i},
+			omitEmpty: hasOption(options, "omitempty"),
+			asString:  hasOption(options, "string"),
+		})
+	}
+	return fields
+}
+
+// structClass returns the class alias set on t by the `class` option of a
+// blank field, or "" if there is none.
+func structClass(t reflect.Type) string {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Name != "_" {
+			continue
+		}
+		name, options := parseTag(sf.Tag.Get("amf"))
+		if hasOption(options, "class") {
+			return name
+		}
+	}
+	return ""
+}
+
+// isEmptyValue reports whether the field v is omitted by omitempty.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+// formatString formats a number or boolean, or a non-nil pointer to one, for
+// the string option.
+func formatString(v reflect.Value) (string, bool) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return "", false
+		}
+		return formatString(v.Elem())
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), true
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 32), true
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64), true
+	}
+	return "", false
+}
+
+// fieldByIndexNoAlloc returns the field of v at index. ok is false if an
+// embedded struct pointer on the way is nil.
+func fieldByIndexNoAlloc(v reflect.Value, index []int) (f reflect.Value, ok bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return v, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// fieldByIndex returns the field of v at index, allocating embedded struct
+// pointers on the way. ok is false if the field can not be set.
+func fieldByIndex(v reflect.Value, index []int) (f reflect.Value, ok bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return v, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, v.CanSet()
+}
+
+func unmarshalValue(src interface{}, dst reflect.Value, path string, version uint) error {
+	if _, ok := src.(Undefined); ok {
+		return nil
+	}
+	if dst.Kind() != reflect.Ptr && dst.CanAddr() {
+		if u, ok := dst.Addr().Interface().(Unmarshaler); ok {
+			return u.UnmarshalAMF(version, src)
+		}
+	}
+	if src == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+
+	if dst.Kind() != reflect.Interface {
+		switch vt := src.(type) {
+		case XML:
+			return unmarshalXML(string(vt), dst, path)
+		case XMLDocument:
+			return unmarshalXML(string(vt), dst, path)
+		}
+	}
+
+	switch dst.Kind() {
+	case reflect.Interface:
+		if dst.NumMethod() == 0 {
+			dst.Set(reflect.ValueOf(src))
+			return nil
+		}
+	case reflect.Ptr:
+		if sv := reflect.ValueOf(src); sv.Type() == dst.Type() {
+			dst.Set(sv)
+			return nil
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return unmarshalValue(src, dst.Elem(), path, version)
+	case reflect.Bool:
+		if b, ok := src.(bool); ok {
+			dst.SetBool(b)
+			return nil
+		}
+	case reflect.String:
+		if s, ok := src.(string); ok {
+			dst.SetString(s)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if f, ok := numberValue(src); ok {
+			i := int64(f)
+			if float64(i) != f || dst.OverflowInt(i) {
+				return &UnmarshalTypeError{"number " + strconv.FormatFloat(f, 'g', -1, 64), dst.Type(), path}
+			}
+			dst.SetInt(i)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if f, ok := numberValue(src); ok {
+			u := uint64(f)
+			if f < 0 || float64(u) != f || dst.OverflowUint(u) {
+				return &UnmarshalTypeError{"number " + strconv.FormatFloat(f, 'g', -1, 64), dst.Type(), path}
+			}
+			dst.SetUint(u)
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if f, ok := numberValue(src); ok {
+			if dst.OverflowFloat(f) {
+				return &UnmarshalTypeError{"number " + strconv.FormatFloat(f, 'g', -1, 64), dst.Type(), path}
+			}
+			dst.SetFloat(f)
+			return nil
+		}
+	case reflect.Struct:
+		if date, ok := src.(Date); ok && dst.Type() == reflect.TypeOf(date.Time) {
+			dst.Set(reflect.ValueOf(date.Time))
+			return nil
+		}
+		// time.Time, or a struct registered with RegisterClassAlias
+		if sv := reflect.ValueOf(src); sv.Type() == dst.Type() {
+			dst.Set(sv)
+			return nil
+		}
+		if sv := reflect.ValueOf(src); sv.Kind() == reflect.Ptr && sv.Type().Elem() == dst.Type() {
+			dst.Set(sv.Elem())
+			return nil
+		}
+		if obj, ok := objectValue(src); ok {
+			return unmarshalStruct(obj, dst, path, version)
+		}
+	case reflect.Map:
+		if obj, ok := objectValue(src); ok && dst.Type().Key().Kind() == reflect.String {
+			return unmarshalMap(obj, dst, path, version)
+		}
+		if dict, ok := src.(Dictionary); ok {
+			return unmarshalDictionary(dict, dst, path, version)
+		}
+	case reflect.Slice:
+		if b, ok := src.([]byte); ok && dst.Type().Elem().Kind() == reflect.Uint8 {
+			dst.SetBytes(append([]byte(nil), b...))
+			return nil
+		}
+		if arr, ok := arrayValue(src); ok {
+			dst.Set(reflect.MakeSlice(dst.Type(), len(arr), len(arr)))
+			return unmarshalArray(arr, dst, path, version)
+		}
+	case reflect.Array:
+		if arr, ok := arrayValue(src); ok && len(arr) <= dst.Len() {
+			dst.Set(reflect.Zero(dst.Type()))
+			return unmarshalArray(arr, dst, path, version)
+		}
+	}
+	return &UnmarshalTypeError{amfTypeName(src), dst.Type(), path}
+}
+
+// unmarshalXML stores an XML payload into a string, or parses it into any
+// other value through encoding/xml.
+func unmarshalXML(data string, dst reflect.Value, path string) error {
+	switch dst.Kind() {
+	case reflect.String:
+		dst.SetString(data)
+		return nil
+	case reflect.Ptr:
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return unmarshalXML(data, dst.Elem(), path)
+	}
+	if !dst.CanAddr() {
+		return &UnmarshalTypeError{"xml", dst.Type(), path}
+	}
+	return xml.Unmarshal([]byte(data), dst.Addr().Interface())
+}
+
+func unmarshalStruct(obj Object, dst reflect.Value, path string, version uint) error {
+	for _, f := range structFields(dst.Type()) {
+		value, ok := obj[f.name]
+		if !ok {
+			continue
+		}
+		fv, ok := fieldByIndex(dst, f.index)
+		if !ok {
+			continue
+		}
+		if str, ok := value.(string); ok && f.asString {
+			err := unmarshalString(str, fv, joinPath(path, f.name))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err := unmarshalValue(value, fv, joinPath(path, f.name), version)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unmarshalString parses a number or boolean written with the string option,
+// allocating dst first if it is a pointer.
+func unmarshalString(str string, dst reflect.Value, path string) error {
+	switch dst.Kind() {
+	case reflect.Ptr:
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return unmarshalString(str, dst.Elem(), path)
+	case reflect.String:
+		dst.SetString(str)
+		return nil
+	case reflect.Bool:
+		if b, err := strconv.ParseBool(str); err == nil {
+			dst.SetBool(b)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i, err := strconv.ParseInt(str, 10, 64); err == nil && !dst.OverflowInt(i) {
+			dst.SetInt(i)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u, err := strconv.ParseUint(str, 10, 64); err == nil && !dst.OverflowUint(u) {
+			dst.SetUint(u)
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if f, err := strconv.ParseFloat(str, 64); err == nil && !dst.OverflowFloat(f) {
+			dst.SetFloat(f)
+			return nil
+		}
+	}
+	return &UnmarshalTypeError{"string " + strconv.Quote(str), dst.Type(), path}
+}
+
+func unmarshalMap(obj Object, dst reflect.Value, path string, version uint) error {
+	t := dst.Type()
+	if dst.IsNil() {
+		dst.Set(reflect.MakeMapWithSize(t, len(obj)))
+	}
+	for key, value := range obj {
+		elem := reflect.New(t.Elem()).Elem()
+		err := unmarshalValue(value, elem, joinPath(path, key), version)
+		if err != nil {
+			return err
+		}
+		dst.SetMapIndex(reflect.ValueOf(key).Convert(t.Key()), elem)
+	}
+	return nil
+}
+
+func unmarshalDictionary(dict Dictionary, dst reflect.Value, path string, version uint) error {
+	t := dst.Type()
+	if dst.IsNil() {
+		dst.Set(reflect.MakeMapWithSize(t, len(dict.Entries)))
+	}
+	for _, entry := range dict.Entries {
+		k := reflect.New(t.Key()).Elem()
+		name := fmt.Sprint(entry.Key)
+		err := unmarshalValue(entry.Key, k, joinPath(path, name), version)
+		if err != nil {
+			return err
+		}
+		if k.Kind() == reflect.Interface && !k.IsNil() && !k.Elem().Type().Comparable() {
+			return &UnmarshalTypeError{amfTypeName(entry.Key) + " key", t, path}
+		}
+		elem := reflect.New(t.Elem()).Elem()
+		err = unmarshalValue(entry.Value, elem, joinPath(path, name), version)
+		if err != nil {
+			return err
+		}
+		dst.SetMapIndex(k, elem)
+	}
+	return nil
+}
+
+func unmarshalArray(arr []interface{}, dst reflect.Value, path string, version uint) error {
+	for i, value := range arr {
+		err := unmarshalValue(value, dst.Index(i), fmt.Sprintf("%s[%d]", path, i), version)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func joinPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// numberValue returns the value of a decoded AMF number as float64.
+func numberValue(src interface{}) (float64, bool) {
+	if num, ok := src.(Number); ok {
+		return num.Value, true
+	}
+	v := reflect.ValueOf(src)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+// objectValue returns the properties of a decoded object.
+func objectValue(src interface{}) (Object, bool) {
+	switch vt := src.(type) {
+	case Object:
+		return vt, true
+	case TypedObject:
+		return vt.Object, true
+	case EcmaArray:
+		return vt.Object, true
+	case OrderedObject:
+		return vt.Object(), true
+	case OrderedEcmaArray:
+		return vt.Properties.Object(), true
+	}
+	return nil, false
+}
+
+// arrayValue returns the elements of a decoded array. ECMA arrays and
+// objects are accepted if the keys are the indices 0..n-1.
+func arrayValue(src interface{}) ([]interface{}, bool) {
+	switch vt := src.(type) {
+	case EcmaArray:
+		src = vt.Object
+	case OrderedEcmaArray:
+		src = vt.Properties.Object()
+	}
+	switch vt := src.(type) {
+	case []interface{}:
+		return vt, true
+	case MixedArray:
+		return vt.Dense, true
+	case VectorInt:
+		return interfaceSlice(vt.Items), true
+	case VectorUint:
+		return interfaceSlice(vt.Items), true
+	case VectorDouble:
+		return interfaceSlice(vt.Items), true
+	case VectorObject:
+		return vt.Items, true
+	case Object:
+		arr := make([]interface{}, len(vt))
+		for key, value := range vt {
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(arr) {
+				return nil, false
+			}
+			arr[i] = value
+		}
+		return arr, true
+	}
+	return nil, false
+}
+
+func interfaceSlice(items interface{}) []interface{} {
+	v := reflect.ValueOf(items)
+	arr := make([]interface{}, v.Len())
+	for i := range arr {
+		arr[i] = v.Index(i).Interface()
+	}
+	return arr
+}
+
+// amfTypeName describes a decoded value in error messages.
+func amfTypeName(src interface{}) string {
+	switch vt := src.(type) {
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case Object, OrderedObject:
+		return "object"
+	case EcmaArray, OrderedEcmaArray:
+		return "ecma array"
+	case TypedObject:
+		return "object " + vt.ClassName
+	case []interface{}, MixedArray:
+		return "array"
+	case VectorInt, VectorUint, VectorDouble, VectorObject:
+		return "vector"
+	case Dictionary:
+		return "dictionary"
+	case []byte:
+		return "byte array"
+	case time.Time, Date:
+		return "date"
+	}
+	if _, ok := numberValue(src); ok {
+		return "number"
+	}
+	return fmt.Sprintf("%T", src)
+}
@@ -0,0 +1,221 @@
+// Copyright (c) 2022 Furzoom.com, All rights reserved.
+// Author: mn, mn@furzoom.com
+
+package goamf
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type unmarshalAddress struct {
+	City string `amf:"city"`
+}
+
+type unmarshalBase struct {
+	ID int `amf:"id"`
+}
+
+type unmarshalUser struct {
+	unmarshalBase
+	Name    string            `amf:"name"`
+	Age     uint8             `amf:"age"`
+	Tags    []string          `amf:"tags"`
+	Address *unmarshalAddress `amf:"address"`
+	Extra   map[string]int    `amf:"extra"`
+	Ignored string            `amf:"-"`
+	Any     interface{}
+}
+
+func TestUnmarshal(t *testing.T) {
+	buf := new(bytes.Buffer)
+	_, err := WriteValue(buf, Object{
+		"id":      7,
+		"name":    "zhang",
+		"age":     30,
+		"tags":    []interface{}{"a", "b"},
+		"address": Object{"city": "beijing"},
+		"extra":   Object{"x": 1},
+		"Ignored": "foo",
+		"Any":     true,
+	})
+	if err != nil {
+		t.Fatalf("WriteValue error: %s", err)
+	}
+	var got unmarshalUser
+	err = Unmarshal(buf.Bytes(), AMF0, &got)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %s", err)
+	}
+	expect := unmarshalUser{
+		unmarshalBase: unmarshalBase{7},
+		Name:          "zhang",
+		Age:           30,
+		Tags:          []string{"a", "b"},
+		Address:       &unmarshalAddress{"beijing"},
+		Extra:         map[string]int{"x": 1},
+		Any:           true,
+	}
+	if !reflect.DeepEqual(expect, got) {
+		t.Errorf("Unmarshal expect %+v got %+v", expect, got)
+	}
+}
+
+func TestUnmarshal_AMF3(t *testing.T) {
+	buf := []byte{0x0A, 0x0B, 0x01,
+		0x09, 'c', 'i', 't', 'y', 0x06, 0x07, 'f', 'o', 'o',
+		0x01,
+	}
+	var got unmarshalAddress
+	err := Unmarshal(buf, AMF3, &got)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %s", err)
+	}
+	if got.City != "foo" {
+		t.Errorf("Unmarshal expect foo got %s", got.City)
+	}
+}
+
+func TestUnmarshal_TypeError(t *testing.T) {
+	buf := new(bytes.Buffer)
+	_, err := WriteValue(buf, Object{"tags": []interface{}{"a", 1}})
+	if err != nil {
+		t.Fatalf("WriteValue error: %s", err)
+	}
+	var got unmarshalUser
+	err = Unmarshal(buf.Bytes(), AMF0, &got)
+	e, ok := err.(*UnmarshalTypeError)
+	if !ok {
+		t.Fatalf("Unmarshal expect UnmarshalTypeError got %v", err)
+	}
+	if e.Field != "tags[1]" {
+		t.Errorf("UnmarshalTypeError field expect tags[1] got %s", e.Field)
+	}
+	expect := "cannot unmarshal number into Go struct field tags[1] of type string"
+	if e.Error() != expect {
+		t.Errorf("UnmarshalTypeError expect %q got %q", expect, e.Error())
+	}
+
+	err = Unmarshal(buf.Bytes(), AMF0, got)
+	if _, ok := err.(*InvalidUnmarshalError); !ok {
+		t.Errorf("Unmarshal expect InvalidUnmarshalError got %v", err)
+	}
+}
+
+func TestUnmarshal_XML(t *testing.T) {
+	buf := []byte{0x0A, 0x0B, 0x01,
+		0x03, 'A', 0x0B, 0x11, '<', 'a', '>', 'b', '<', '/', 'a', '>',
+		0x03, 'C', 0x07, 0x09, '<', 'c', '/', '>',
+		0x01,
+	}
+	var got struct {
+		A struct {
+			B string `xml:",chardata"`
+		}
+		C string
+	}
+	err := Unmarshal(buf, AMF3, &got)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %s", err)
+	}
+	if got.A.B != "b" {
+		t.Errorf("Unmarshal XML into struct got %+v", got.A)
+	}
+	if got.C != "<c/>" {
+		t.Errorf("Unmarshal XMLDocument into string got %q", got.C)
+	}
+}
+
+type taggedMeta struct {
+	Owner string `amf:"owner"`
+}
+
+type tagged struct {
+	_    struct{}   `amf:"test.Tagged,class"`
+	ID   int64      `amf:"id,string"`
+	Note string     `amf:"note,omitempty"`
+	Tags []string   `amf:"tags,omitempty"`
+	Opt  *int       `amf:",omitempty"`
+	Meta taggedMeta `amf:"meta,inline"`
+}
+
+func TestStructTagOptions(t *testing.T) {
+	value := tagged{ID: 42, Tags: []string{}, Meta: taggedMeta{"x"}}
+	buf := new(bytes.Buffer)
+	_, err := WriteValue(buf, value)
+	if err != nil {
+		t.Fatalf("WriteValue error: %s", err)
+	}
+	expect := []byte{0x10, 0x00, 0x0b, 't', 'e', 's', 't', '.', 'T', 'a', 'g', 'g', 'e', 'd',
+		0x00, 0x02, 'i', 'd', 0x02, 0x00, 0x02, '4', '2',
+		0x00, 0x05, 'o', 'w', 'n', 'e', 'r', 0x02, 0x00, 0x01, 'x',
+		0x00, 0x00, 0x09,
+	}
+	if !bytes.Equal(buf.Bytes(), expect) {
+		t.Errorf("WriteValue expect %x got %x", expect, buf.Bytes())
+	}
+	var got tagged
+	err = Unmarshal(buf.Bytes(), AMF0, &got)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %s", err)
+	}
+	if got.ID != 42 || got.Meta.Owner != "x" {
+		t.Errorf("Unmarshal got %+v", got)
+	}
+
+	buf.Reset()
+	_, err = Amf3WriteValue(buf, value)
+	if err != nil {
+		t.Fatalf("Amf3WriteValue error: %s", err)
+	}
+	expect = []byte{0x0A, 0x23, 0x17, 't', 'e', 's', 't', '.', 'T', 'a', 'g', 'g', 'e', 'd',
+		0x05, 'i', 'd', 0x0b, 'o', 'w', 'n', 'e', 'r',
+		0x06, 0x05, '4', '2', 0x06, 0x03, 'x',
+	}
+	if !bytes.Equal(buf.Bytes(), expect) {
+		t.Errorf("Amf3WriteValue expect %x got %x", expect, buf.Bytes())
+	}
+	got = tagged{}
+	err = Unmarshal(buf.Bytes(), AMF3, &got)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %s", err)
+	}
+	if got.ID != 42 || got.Meta.Owner != "x" {
+		t.Errorf("Unmarshal got %+v", got)
+	}
+
+	err = Unmarshal([]byte{0x03, 0x00, 0x02, 'i', 'd', 0x02, 0x00, 0x01, 'z', 0x00, 0x00, 0x09}, AMF0, &got)
+	if _, ok := err.(*UnmarshalTypeError); !ok {
+		t.Errorf("Unmarshal expect UnmarshalTypeError got %v", err)
+	}
+}
+
+func TestStructTagStringPointer(t *testing.T) {
+	type s struct {
+		N *int `amf:"n,string"`
+		M *int `amf:"m,string"`
+	}
+	n := 7
+	buf := new(bytes.Buffer)
+	_, err := WriteValue(buf, s{N: &n})
+	if err != nil {
+		t.Fatalf("WriteValue error: %s", err)
+	}
+	expect := []byte{0x03,
+		0x00, 0x01, 'n', 0x02, 0x00, 0x01, '7',
+		0x00, 0x01, 'm', 0x05,
+		0x00, 0x00, 0x09,
+	}
+	if !bytes.Equal(buf.Bytes(), expect) {
+		t.Errorf("WriteValue expect %x got %x", expect, buf.Bytes())
+	}
+	var got s
+	err = Unmarshal(expect, AMF0, &got)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %s", err)
+	}
+	if got.N == nil || *got.N != 7 || got.M != nil {
+		t.Errorf("Unmarshal got %+v", got)
+	}
+}